@@ -0,0 +1,172 @@
+package scanx
+
+import (
+	"image"
+	"image/color"
+)
+
+// Bitmap is an in-memory image of 1 bit per pixel, as used by receipt
+// printers and e-paper displays. Rows are packed most significant bit
+// first, and a set bit is a black (inked) pixel.
+type Bitmap struct {
+	Pix    []uint8
+	Stride int
+	Rect   image.Rectangle
+}
+
+// BitmapModel converts colors to black or white by thresholding their gray
+// level, as composited over white, at the midpoint.
+var BitmapModel = color.ModelFunc(func(c color.Color) color.Color {
+	if grayOverWhite(getColorRGBA(c)) < 0x80 {
+		return color.Gray{}
+	}
+	return color.Gray{Y: 0xFF}
+})
+
+// NewBitmap returns a new white Bitmap with the given bounds.
+func NewBitmap(r image.Rectangle) *Bitmap {
+	stride := (r.Dx() + 7) / 8
+	return &Bitmap{Pix: make([]uint8, stride*r.Dy()), Stride: stride, Rect: r}
+}
+
+// grayOverWhite returns the gray level of the premultiplied color c
+// composited over a white background, weighted as by color.GrayModel.
+func grayOverWhite(c color.RGBA) uint32 {
+	w := 0xFF - uint32(c.A)
+	r := (uint32(c.R) + w) * 0x101
+	g := (uint32(c.G) + w) * 0x101
+	b := (uint32(c.B) + w) * 0x101
+	return (19595*r + 38470*g + 7471*b + 1<<15) >> 24
+}
+
+// ColorModel returns the image's color model.
+func (p *Bitmap) ColorModel() color.Model {
+	return BitmapModel
+}
+
+// Bounds returns the domain for which At can return non-zero color.
+func (p *Bitmap) Bounds() image.Rectangle {
+	return p.Rect
+}
+
+// BitOffset returns the index of the byte of Pix holding the pixel at
+// (x, y), and the mask of its bit within that byte.
+func (p *Bitmap) BitOffset(x, y int) (int, uint8) {
+	dx := x - p.Rect.Min.X
+	return (y-p.Rect.Min.Y)*p.Stride + dx>>3, 0x80 >> uint(dx&7)
+}
+
+// At returns the color of the pixel at (x, y).
+func (p *Bitmap) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return color.Gray{}
+	}
+	i, mask := p.BitOffset(x, y)
+	if p.Pix[i]&mask != 0 {
+		return color.Gray{}
+	}
+	return color.Gray{Y: 0xFF}
+}
+
+// Set sets the pixel at (x, y) to black or white as chosen by BitmapModel.
+func (p *Bitmap) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	i, mask := p.BitOffset(x, y)
+	if BitmapModel.Convert(c).(color.Gray).Y == 0 {
+		p.Pix[i] |= mask
+	} else {
+		p.Pix[i] &^= mask
+	}
+}
+
+// SetThreshold sets the gray level, over white, below which DrawToImage
+// inks a *Bitmap pixel. Until it is set the threshold is the midpoint, 0x80.
+// A threshold of 0 inks no pixels, unless error diffusion pushes a pixel
+// below it.
+func (x *LinkListSpanner) SetThreshold(level uint8) {
+	x.threshold, x.useThreshold = level, true
+}
+
+// bitmapThreshold returns the gray level below which pixels are inked.
+func (x *LinkListSpanner) bitmapThreshold() int32 {
+	if !x.useThreshold {
+		return 0x80
+	}
+	return int32(x.threshold)
+}
+
+// grayRow fills row with the gray level over white of each pixel in row y,
+// starting at column x0, or with -1 for pixels not covered by any span.
+func (x *LinkListSpanner) grayRow(y, x0 int, row []int32) {
+	for i := range row {
+		row[i] = -1
+	}
+	r := image.Rect(x0, y, x0+len(row), y+1)
+	for spCell := range x.spans.row(y - x.bounds.Min.Y) {
+		g := int32(grayOverWhite(spCell.clr))
+		c0, c1 := clipCell(spCell, r)
+		for i := c0; i < c1; i++ {
+			row[i-x0] = g
+		}
+	}
+}
+
+// spansToBitmap writes the covered pixels of r, translated by d, into img,
+// inking pixels by threshold, ordered dithering or error diffusion. The error
+// of a pixel is only diffused to covered pixels.
+func (x *LinkListSpanner) spansToBitmap(img *Bitmap, r image.Rectangle, d image.Point) {
+	w := r.Dx()
+	threshold := x.bitmapThreshold()
+	// error rows for y, y+1 and y+2, padded by two pixels on each side
+	errs := [3][]int32{make([]int32, w+4), make([]int32, w+4), make([]int32, w+4)}
+	row := make([]int32, w)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		x.grayRow(y, r.Min.X, row)
+		dy := y + d.Y
+		cur, next, next2 := errs[0], errs[1], errs[2]
+		for i, g := range row {
+			if g < 0 {
+				continue
+			}
+			dx := r.Min.X + i + d.X
+			t := threshold
+			if x.Dither == OrderedDither {
+				// spread the threshold over the 16 Bayer levels around its value
+				t += int32(bayer4[dy&3][dx&3])*0x10 - 0x78
+			}
+			o := i + 2 // index into the padded error rows
+			v := g + cur[o]
+			out := int32(0xFF)
+			bi, mask := img.BitOffset(dx, dy)
+			if v < t {
+				out = 0
+				img.Pix[bi] |= mask
+			} else {
+				img.Pix[bi] &^= mask
+			}
+			e := v - out
+			switch x.Dither {
+			case FloydSteinberg:
+				cur[o+1] += e * 7 / 16
+				next[o-1] += e * 3 / 16
+				next[o] += e * 5 / 16
+				next[o+1] += e / 16
+			case Atkinson:
+				e /= 8
+				cur[o+1] += e
+				cur[o+2] += e
+				next[o-1] += e
+				next[o] += e
+				next[o+1] += e
+				next2[o] += e
+			}
+		}
+		// rotate the error rows, clearing the one that becomes y+2
+		errs[0], errs[1], errs[2] = errs[1], errs[2], errs[0]
+		for i := range errs[2] {
+			errs[2][i] = 0
+		}
+	}
+}
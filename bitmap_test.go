@@ -0,0 +1,117 @@
+package scanx_test
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+	"github.com/srwiley/scanx"
+)
+
+// inked reports whether the premultiplied c, composited over white, is darker than threshold.
+func inked(c color.RGBA, threshold uint8) bool {
+	w := 0xFF - c.A
+	g := color.GrayModel.Convert(color.RGBA{c.R + w, c.G + w, c.B + w, 0xFF}).(color.Gray)
+	return g.Y < threshold
+}
+
+func TestBitmapThreshold(t *testing.T) {
+	width, height := 203, 175 // odd width leaves padding bits in each row
+	bounds := image.Rect(0, 0, width, height)
+	rgba := image.NewRGBA(bounds)
+	svgs, err := FilePathWalkDir("testdata/svg/landscapeIcons")
+	if err != nil {
+		t.Fatal("cannot walk file path testdata/svg/landscapeIcons")
+	}
+	for _, f := range svgs {
+		icon, errSvg := oksvg.ReadIcon(f, oksvg.WarnErrorMode)
+		if errSvg != nil {
+			t.Fatal("cannot read icon", errSvg)
+		}
+		icon.SetTarget(0, 0, float64(width), float64(height))
+		spanner := &scanx.LinkListSpanner{}
+		spanner.SetBounds(bounds)
+		icon.Draw(rasterx.NewDasher(width, height, scanx.NewScanner(spanner, width, height)), 1.0)
+		Clear(rgba)
+		spanner.DrawToImage(rgba)
+		for i, threshold := range []uint8{0x80, 0, 0x40, 0xC8} {
+			if i > 0 { // the first pass checks the default
+				spanner.SetThreshold(threshold)
+			}
+			img := scanx.NewBitmap(bounds)
+			spanner.DrawToImage(img)
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					want := inked(rgba.RGBAAt(x, y), threshold)
+					i, mask := img.BitOffset(x, y)
+					if got := img.Pix[i]&mask != 0; got != want {
+						t.Fatalf("%s threshold %d: pixel %d,%d inked %v, want %v", f, threshold, x, y, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestBitmapDiffusion(t *testing.T) {
+	const size = 64
+	bounds := image.Rect(0, 0, size, size)
+	spanner := &scanx.LinkListSpanner{}
+	spanner.SetBounds(bounds)
+	spanner.SetColor(color.RGBA{0x40, 0x40, 0x40, 0xFF})
+	span := spanner.GetSpanFunc()
+	for y := 0; y < size; y++ {
+		span(y, 0, size, 0xFFFF)
+	}
+	for _, tc := range []struct {
+		dither   scanx.DitherMode
+		min, max int
+	}{
+		{scanx.NoDither, size * size, size * size},
+		{scanx.OrderedDither, size * size * 5 / 8, size * size * 7 / 8},
+		{scanx.FloydSteinberg, size * size * 5 / 8, size * size * 7 / 8},
+		{scanx.Atkinson, size * size * 5 / 8, size * size * 7 / 8},
+	} {
+		spanner.Dither = tc.dither
+		img := scanx.NewBitmap(bounds)
+		spanner.DrawToImage(img)
+		n := 0
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				if img.At(x, y).(color.Gray).Y == 0 {
+					n++
+				}
+			}
+		}
+		if n < tc.min || n > tc.max {
+			t.Errorf("dither %d inked %d pixels, want %d to %d", tc.dither, n, tc.min, tc.max)
+		}
+	}
+}
+
+func TestBitmapUncovered(t *testing.T) {
+	// pixels that no span covers are left unchanged, as for other images
+	bounds := image.Rect(0, 0, 16, 4)
+	spanner := &scanx.LinkListSpanner{}
+	spanner.SetBounds(bounds)
+	fillRect(spanner, color.RGBA{0x10, 0x10, 0x10, 0x10}, image.Rect(4, 0, 12, 4))
+	for _, dither := range []scanx.DitherMode{scanx.NoDither, scanx.OrderedDither, scanx.FloydSteinberg, scanx.Atkinson} {
+		spanner.Dither = dither
+		img := scanx.NewBitmap(bounds)
+		for i := range img.Pix {
+			img.Pix[i] = 0xFF
+		}
+		spanner.DrawToImage(img)
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 16; x++ {
+				want := x < 4 || x >= 12
+				i, mask := img.BitOffset(x, y)
+				if got := img.Pix[i]&mask != 0; got != want {
+					t.Errorf("dither %d: pixel %d,%d inked %v, want %v", dither, x, y, got, want)
+				}
+			}
+		}
+	}
+}
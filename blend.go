@@ -0,0 +1,183 @@
+package scanx
+
+import "math"
+
+// BlendMode is a CSS/SVG mix-blend-mode. It mixes the source color with the
+// destination color before the Porter-Duff operator of the spanner is
+// applied, as specified by the W3C Compositing and Blending Level 1
+// recommendation.
+type BlendMode int
+
+// Blend modes, in the order they are listed by the W3C specification.
+const (
+	BlendNormal BlendMode = iota
+	BlendMultiply
+	BlendScreen
+	BlendOverlay
+	BlendDarken
+	BlendLighten
+	BlendColorDodge
+	BlendColorBurn
+	BlendHardLight
+	BlendSoftLight
+	BlendDifference
+	BlendExclusion
+	BlendHue
+	BlendSaturation
+	BlendColor
+	BlendLuminosity
+)
+
+// blendSeparable returns B(cb, cs) for the separable blend modes.
+func blendSeparable(mode BlendMode, cb, cs float64) float64 {
+	switch mode {
+	case BlendMultiply:
+		return cb * cs
+	case BlendScreen:
+		return cb + cs - cb*cs
+	case BlendOverlay:
+		return blendSeparable(BlendHardLight, cs, cb)
+	case BlendDarken:
+		return math.Min(cb, cs)
+	case BlendLighten:
+		return math.Max(cb, cs)
+	case BlendColorDodge:
+		if cb == 0 {
+			return 0
+		}
+		if cs >= 1 {
+			return 1
+		}
+		return math.Min(1, cb/(1-cs))
+	case BlendColorBurn:
+		if cb >= 1 {
+			return 1
+		}
+		if cs == 0 {
+			return 0
+		}
+		return 1 - math.Min(1, (1-cb)/cs)
+	case BlendHardLight:
+		if cs <= 0.5 {
+			return cb * 2 * cs
+		}
+		cs = 2*cs - 1
+		return cb + cs - cb*cs
+	case BlendSoftLight:
+		if cs <= 0.5 {
+			return cb - (1-2*cs)*cb*(1-cb)
+		}
+		d := math.Sqrt(cb)
+		if cb <= 0.25 {
+			d = ((16*cb-12)*cb + 4) * cb
+		}
+		return cb + (2*cs-1)*(d-cb)
+	case BlendDifference:
+		return math.Abs(cb - cs)
+	case BlendExclusion:
+		return cb + cs - 2*cb*cs
+	}
+	return cs
+}
+
+type rgbF struct{ r, g, b float64 }
+
+func lum(c rgbF) float64 {
+	return 0.3*c.r + 0.59*c.g + 0.11*c.b
+}
+
+func clipColor(c rgbF) rgbF {
+	l := lum(c)
+	n := math.Min(c.r, math.Min(c.g, c.b))
+	x := math.Max(c.r, math.Max(c.g, c.b))
+	if n < 0 {
+		c = rgbF{l + (c.r-l)*l/(l-n), l + (c.g-l)*l/(l-n), l + (c.b-l)*l/(l-n)}
+	}
+	if x > 1 {
+		c = rgbF{l + (c.r-l)*(1-l)/(x-l), l + (c.g-l)*(1-l)/(x-l), l + (c.b-l)*(1-l)/(x-l)}
+	}
+	return c
+}
+
+func setLum(c rgbF, l float64) rgbF {
+	d := l - lum(c)
+	return clipColor(rgbF{c.r + d, c.g + d, c.b + d})
+}
+
+func sat(c rgbF) float64 {
+	return math.Max(c.r, math.Max(c.g, c.b)) - math.Min(c.r, math.Min(c.g, c.b))
+}
+
+// setSat scales the channels of c so that max-min equals s, keeping their order.
+func setSat(c rgbF, s float64) rgbF {
+	ch := [3]*float64{&c.r, &c.g, &c.b}
+	// sort the channel pointers into min, mid, max
+	if *ch[0] > *ch[1] {
+		ch[0], ch[1] = ch[1], ch[0]
+	}
+	if *ch[1] > *ch[2] {
+		ch[1], ch[2] = ch[2], ch[1]
+	}
+	if *ch[0] > *ch[1] {
+		ch[0], ch[1] = ch[1], ch[0]
+	}
+	mn, mid, mx := ch[0], ch[1], ch[2]
+	if *mx > *mn {
+		*mid = (*mid - *mn) * s / (*mx - *mn)
+		*mx = s
+	} else {
+		*mid, *mx = 0, 0
+	}
+	*mn = 0
+	return c
+}
+
+// blendNonSeparable returns B(cb, cs) for the non-separable blend modes.
+func blendNonSeparable(mode BlendMode, cb, cs rgbF) rgbF {
+	switch mode {
+	case BlendHue:
+		return setLum(setSat(cs, sat(cb)), lum(cb))
+	case BlendSaturation:
+		return setLum(setSat(cb, sat(cs)), lum(cb))
+	case BlendColor:
+		return setLum(cs, lum(cb))
+	case BlendLuminosity:
+		return setLum(cb, lum(cs))
+	}
+	return cs
+}
+
+// blend16 mixes the premultiplied 16 bit source color with the premultiplied
+// 16 bit backdrop color according to mode, and returns the premultiplied
+// source color that is then composited with the Porter-Duff operator:
+//
+//	Cs' = (1 - ab) * Cs + ab * B(Cb, Cs)
+func blend16(mode BlendMode, sr, sg, sb, sa, dr, dg, db, da uint32) (r, g, b uint32) {
+	if sa == 0 || da == 0 {
+		return sr, sg, sb
+	}
+	fsa, fda := float64(sa), float64(da)
+	cs := rgbF{float64(sr) / fsa, float64(sg) / fsa, float64(sb) / fsa}
+	cb := rgbF{float64(dr) / fda, float64(dg) / fda, float64(db) / fda}
+	var mixed rgbF
+	if mode >= BlendHue {
+		mixed = blendNonSeparable(mode, cb, cs)
+	} else {
+		mixed = rgbF{
+			blendSeparable(mode, cb.r, cs.r),
+			blendSeparable(mode, cb.g, cs.g),
+			blendSeparable(mode, cb.b, cs.b)}
+	}
+	ab := fda / m
+	toPre := func(cs, b float64) uint32 {
+		v := ((1-ab)*cs + ab*b) * fsa
+		if v <= 0 {
+			return 0
+		}
+		if v >= fsa {
+			return sa
+		}
+		return uint32(v + 0.5)
+	}
+	return toPre(cs.r, mixed.r), toPre(cs.g, mixed.g), toPre(cs.b, mixed.b)
+}
@@ -0,0 +1,255 @@
+package scanx_test
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/BurntSushi/xgbutil/xgraphics"
+	"github.com/srwiley/rasterx"
+	"github.com/srwiley/scanx"
+)
+
+var blendModes = []scanx.BlendMode{scanx.BlendNormal, scanx.BlendMultiply,
+	scanx.BlendScreen, scanx.BlendOverlay, scanx.BlendDarken, scanx.BlendLighten,
+	scanx.BlendColorDodge, scanx.BlendColorBurn, scanx.BlendHardLight,
+	scanx.BlendSoftLight, scanx.BlendDifference, scanx.BlendExclusion,
+	scanx.BlendHue, scanx.BlendSaturation, scanx.BlendColor, scanx.BlendLuminosity}
+
+// The reference functions below transcribe the W3C Compositing and Blending
+// Level 1 formulas as directly as possible.
+
+func refSeparable(mode scanx.BlendMode, cb, cs float64) float64 {
+	switch mode {
+	case scanx.BlendMultiply:
+		return cb * cs
+	case scanx.BlendScreen:
+		return 1 - (1-cb)*(1-cs)
+	case scanx.BlendOverlay:
+		return refSeparable(scanx.BlendHardLight, cs, cb)
+	case scanx.BlendDarken:
+		return math.Min(cb, cs)
+	case scanx.BlendLighten:
+		return math.Max(cb, cs)
+	case scanx.BlendColorDodge:
+		switch {
+		case cb == 0:
+			return 0
+		case cs == 1:
+			return 1
+		}
+		return math.Min(1, cb/(1-cs))
+	case scanx.BlendColorBurn:
+		switch {
+		case cb == 1:
+			return 1
+		case cs == 0:
+			return 0
+		}
+		return 1 - math.Min(1, (1-cb)/cs)
+	case scanx.BlendHardLight:
+		if cs <= 0.5 {
+			return refSeparable(scanx.BlendMultiply, cb, 2*cs)
+		}
+		return refSeparable(scanx.BlendScreen, cb, 2*cs-1)
+	case scanx.BlendSoftLight:
+		if cs <= 0.5 {
+			return cb - (1-2*cs)*cb*(1-cb)
+		}
+		var d float64
+		if cb <= 0.25 {
+			d = ((16*cb-12)*cb + 4) * cb
+		} else {
+			d = math.Sqrt(cb)
+		}
+		return cb + (2*cs-1)*(d-cb)
+	case scanx.BlendDifference:
+		return math.Abs(cb - cs)
+	case scanx.BlendExclusion:
+		return cb + cs - 2*cb*cs
+	}
+	return cs
+}
+
+func refLum(c [3]float64) float64 { return 0.3*c[0] + 0.59*c[1] + 0.11*c[2] }
+
+func refClipColor(c [3]float64) [3]float64 {
+	l := refLum(c)
+	n := math.Min(c[0], math.Min(c[1], c[2]))
+	x := math.Max(c[0], math.Max(c[1], c[2]))
+	for k := range c {
+		if n < 0 {
+			c[k] = l + (c[k]-l)*l/(l-n)
+		}
+	}
+	for k := range c {
+		if x > 1 {
+			c[k] = l + (c[k]-l)*(1-l)/(x-l)
+		}
+	}
+	return c
+}
+
+func refSetLum(c [3]float64, l float64) [3]float64 {
+	d := l - refLum(c)
+	return refClipColor([3]float64{c[0] + d, c[1] + d, c[2] + d})
+}
+
+func refSat(c [3]float64) float64 {
+	return math.Max(c[0], math.Max(c[1], c[2])) - math.Min(c[0], math.Min(c[1], c[2]))
+}
+
+func refSetSat(c [3]float64, s float64) [3]float64 {
+	idx := []int{0, 1, 2}
+	sort.SliceStable(idx, func(i, j int) bool { return c[idx[i]] < c[idx[j]] })
+	mn, mid, mx := idx[0], idx[1], idx[2]
+	var r [3]float64
+	if c[mx] > c[mn] {
+		r[mid] = (c[mid] - c[mn]) * s / (c[mx] - c[mn])
+		r[mx] = s
+	}
+	return r
+}
+
+func refBlend(mode scanx.BlendMode, cb, cs [3]float64) (b [3]float64) {
+	switch mode {
+	case scanx.BlendHue:
+		return refSetLum(refSetSat(cs, refSat(cb)), refLum(cb))
+	case scanx.BlendSaturation:
+		return refSetLum(refSetSat(cb, refSat(cs)), refLum(cb))
+	case scanx.BlendColor:
+		return refSetLum(cs, refLum(cb))
+	case scanx.BlendLuminosity:
+		return refSetLum(cb, refLum(cs))
+	}
+	for k := range b {
+		b[k] = refSeparable(mode, cb[k], cs[k])
+	}
+	return
+}
+
+// refBlendOver returns the premultiplied result, scaled to 255, of blending
+// src onto dst with source-over compositing at coverage cov:
+//
+//	co = cs*(1 - ab)*as + cb*(1 - as)*ab + as*ab*B(Cb, Cs)
+func refBlendOver(mode scanx.BlendMode, src, dst color.RGBA, cov float64) [4]float64 {
+	as, ab := float64(src.A)/255*cov, float64(dst.A)/255
+	unpre := func(c color.RGBA) (u [3]float64) {
+		if c.A != 0 {
+			u = [3]float64{float64(c.R) / float64(c.A), float64(c.G) / float64(c.A), float64(c.B) / float64(c.A)}
+		}
+		return
+	}
+	cs, cb := unpre(src), unpre(dst)
+	b := refBlend(mode, cb, cs)
+	var co [4]float64
+	for k := 0; k < 3; k++ {
+		co[k] = 255 * (cs[k]*(1-ab)*as + cb[k]*(1-as)*ab + as*ab*b[k])
+	}
+	co[3] = 255 * (as + ab*(1-as))
+	return co
+}
+
+func TestBlendReference(t *testing.T) {
+	colors := []color.RGBA{
+		{0xFF, 0x80, 0x00, 0xFF},
+		{0x10, 0x40, 0x60, 0x80},
+		{0x20, 0xC0, 0x90, 0xE0},
+		{0xC0, 0xC0, 0xC0, 0xFF},
+		{0x00, 0x00, 0x00, 0xFF},
+	}
+	bounds := image.Rect(0, 0, 1, 1)
+	for _, mode := range blendModes {
+		for _, src := range colors {
+			for _, dst := range colors {
+				for _, cov := range []uint32{0xFFFF, 0x9000} {
+					want := refBlendOver(mode, src, dst, float64(cov)/0xFFFF)
+					img := image.NewRGBA(bounds)
+					img.SetRGBA(0, 0, dst)
+					spanner := scanx.NewImgSpanner(img)
+					spanner.Blend = mode
+					spanner.SetColor(src)
+					spanner.GetSpanFunc()(0, 0, 1, cov)
+					got1 := img.RGBAAt(0, 0)
+
+					lspanner := &scanx.LinkListSpanner{}
+					lspanner.SetBounds(bounds)
+					lspanner.Blend = mode
+					lspanner.SetBgColor(dst)
+					lspanner.SetColor(src)
+					lspanner.GetSpanFunc()(0, 0, 1, cov)
+					lspanner.DrawToImage(img)
+					got2 := img.RGBAAt(0, 0)
+
+					for _, got := range []color.RGBA{got1, got2} {
+						for k, v := range [4]uint8{got.R, got.G, got.B, got.A} {
+							if d := float64(v) - want[k]; d < -2 || d > 2 {
+								t.Fatalf("mode %d: %v onto %v at coverage %#x gave %v, want %v",
+									mode, src, dst, cov, got, want)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestBlendSpanners(t *testing.T) {
+	width := 200
+	height := 175
+
+	img1 := image.NewRGBA(image.Rect(0, 0, width, height))
+	img2 := image.NewRGBA(image.Rect(0, 0, width, height))
+	for _, mode := range blendModes {
+		for _, op := range []scanx.CompositeOp{scanx.SrcOver, scanx.SrcAtop} {
+			Clear(img1)
+			Clear(img2)
+			file := "testdata/svg/landscapeIcons/sea.svg"
+			RenderLinkList(t, file, width, height, func(s *scanx.LinkListSpanner) {
+				s.Blend, s.Composite = mode, op
+			}).DrawToImage(img1)
+			RenderImg(t, file, img2, func(s *scanx.ImgSpanner) {
+				s.Blend, s.Composite = mode, op
+			})
+			if d := MaxPixDiff(img1, img2); d != 0 {
+				t.Errorf("mode %d op %d: spanners differ by %d", mode, op, d)
+			}
+		}
+	}
+}
+
+func TestBlendSpannersX(t *testing.T) {
+	// xgraphics.Image stores pixels as BGRA, which the non-separable modes
+	// must not confuse with RGBA, since they weight red and blue differently
+	width, height := 200, 175
+	bounds := image.Rect(0, 0, width, height)
+	file := "testdata/svg/landscapeIcons/sea.svg"
+	for _, mode := range []scanx.BlendMode{scanx.BlendMultiply, scanx.BlendHue,
+		scanx.BlendSaturation, scanx.BlendColor, scanx.BlendLuminosity} {
+		ximg1, ximg2 := xgraphics.New(nil, bounds), xgraphics.New(nil, bounds)
+		spanner := scanx.NewImgSpanner(ximg1)
+		spanner.Blend = mode
+		scanner := scanx.NewScanner(spanner, width, height)
+		ReadTestIcon(t, file, width, height).Draw(rasterx.NewDasher(width, height, scanner), 1.0)
+		RenderLinkList(t, file, width, height, func(s *scanx.LinkListSpanner) {
+			s.Blend = mode
+		}).DrawToImage(ximg2)
+
+		img := image.NewRGBA(bounds)
+		RenderImg(t, file, img, func(s *scanx.ImgSpanner) {
+			s.Blend = mode
+		})
+		for i := 0; i < len(img.Pix); i += 4 {
+			rgba := img.Pix[i : i+4]
+			for k, x := range []*xgraphics.Image{ximg1, ximg2} {
+				bgra := x.Pix[i : i+4]
+				if bgra[0] != rgba[2] || bgra[1] != rgba[1] || bgra[2] != rgba[0] || bgra[3] != rgba[3] {
+					t.Fatalf("mode %d: xgraphics pixel %d of spanner %d is %v, want %v in BGRA order", mode, i/4, k, bgra, rgba)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package scanx
+
+import (
+	"image/color"
+	"math"
+)
+
+type (
+	// A ColorTransform maps the premultiplied color of a span to a new
+	// premultiplied color. ColorMatrix, ComponentTransfer and PaletteMap
+	// are ColorTransforms that LinkListSpanner.ApplyColorTransform can
+	// apply to a finished drawing.
+	ColorTransform interface {
+		TransformRGBA(c color.RGBA) color.RGBA
+	}
+
+	// ColorMatrix transforms colors as the SVG feColorMatrix filter does.
+	// The rows give the red, green, blue and alpha of the new color from
+	// the unpremultiplied red, green, blue and alpha of the old color in
+	// the range 0 to 1, plus the constant in the last column.
+	ColorMatrix [4][5]float64
+
+	// ComponentTransfer transforms the unpremultiplied red, green, blue
+	// and alpha of colors with a function for each channel, as the SVG
+	// feComponentTransfer filter does. A nil function leaves its channel
+	// unchanged.
+	ComponentTransfer [4]func(v uint8) uint8
+
+	// PaletteMap replaces the premultiplied colors that are its keys with
+	// their values, and leaves other colors unchanged.
+	PaletteMap map[color.RGBA]color.RGBA
+)
+
+// SaturateMatrix returns the ColorMatrix of the SVG saturate filter, which
+// gives gray colors for s = 0 and leaves colors unchanged for s = 1.
+func SaturateMatrix(s float64) ColorMatrix {
+	return ColorMatrix{
+		{0.213 + 0.787*s, 0.715 - 0.715*s, 0.072 - 0.072*s, 0, 0},
+		{0.213 - 0.213*s, 0.715 + 0.285*s, 0.072 - 0.072*s, 0, 0},
+		{0.213 - 0.213*s, 0.715 - 0.715*s, 0.072 + 0.928*s, 0, 0},
+		{0, 0, 0, 1, 0},
+	}
+}
+
+// unpremultiply returns the straight alpha color of c.
+func unpremultiply(c color.RGBA) color.NRGBA {
+	if c.A == 0 {
+		return color.NRGBA{}
+	}
+	a := uint32(c.A)
+	return color.NRGBA{
+		R: uint8((uint32(c.R)*0xFF + a/2) / a),
+		G: uint8((uint32(c.G)*0xFF + a/2) / a),
+		B: uint8((uint32(c.B)*0xFF + a/2) / a),
+		A: c.A,
+	}
+}
+
+// premultiply returns the premultiplied color of c.
+func premultiply(c color.NRGBA) color.RGBA {
+	a := uint32(c.A)
+	return color.RGBA{
+		R: uint8((uint32(c.R)*a + 0x7F) / 0xFF),
+		G: uint8((uint32(c.G)*a + 0x7F) / 0xFF),
+		B: uint8((uint32(c.B)*a + 0x7F) / 0xFF),
+		A: c.A,
+	}
+}
+
+// TransformRGBA returns c transformed by the matrix.
+func (m ColorMatrix) TransformRGBA(c color.RGBA) color.RGBA {
+	n := unpremultiply(c)
+	v := [4]float64{float64(n.R) / 0xFF, float64(n.G) / 0xFF, float64(n.B) / 0xFF, float64(n.A) / 0xFF}
+	var out [4]uint8
+	for i, row := range m {
+		f := row[0]*v[0] + row[1]*v[1] + row[2]*v[2] + row[3]*v[3] + row[4]
+		out[i] = uint8(math.Round(math.Max(0, math.Min(1, f)) * 0xFF))
+	}
+	return premultiply(color.NRGBA{out[0], out[1], out[2], out[3]})
+}
+
+// TransformRGBA returns c with each channel transformed by its function.
+func (t ComponentTransfer) TransformRGBA(c color.RGBA) color.RGBA {
+	n := unpremultiply(c)
+	v := [4]*uint8{&n.R, &n.G, &n.B, &n.A}
+	for i, f := range t {
+		if f != nil {
+			*v[i] = f(*v[i])
+		}
+	}
+	return premultiply(n)
+}
+
+// TransformRGBA returns the color that c is mapped to, or c if it is not
+// in the map.
+func (p PaletteMap) TransformRGBA(c color.RGBA) color.RGBA {
+	if r, ok := p[c]; ok {
+		return r
+	}
+	return c
+}
+
+// ApplyColorTransform replaces the color of every accumulated span with its
+// color transformed by t, so a finished drawing can be recolored, for
+// example grayed out or tinted, with one transform per span rather than per
+// pixel. Adjacent spans of a row that become the same color are merged.
+// Transparent covered pixels are transformed too, so a transform that adds
+// alpha colors them. As for Spans, only the top layer is transformed while
+// layers are pushed.
+func (x *LinkListSpanner) ApplyColorTransform(t ColorTransform) {
+	if len(x.spans.rows) < x.bounds.Dy() {
+		return
+	}
+	var cells []cell32
+	for row := 0; row < x.bounds.Dy(); row++ {
+		if pix, cover := x.spans.pixels(row); pix != nil {
+			// dense rows are changed in place, once for each run of a color
+			var from, to color.RGBA
+			ok := false
+			for i, c := range pix {
+				if cover[i>>6]&(1<<uint(i&63)) == 0 {
+					continue
+				}
+				if !ok || c != from {
+					from, to, ok = c, t.TransformRGBA(c), true
+				}
+				pix[i] = to
+			}
+			continue
+		}
+		if len(x.spans.rows[row]) == 0 {
+			continue
+		}
+		cells = cells[:0]
+		for c := range x.spans.row(row) {
+			cells = appendCell(cells, c.x0, c.x1, t.TransformRGBA(c.clr))
+		}
+		x.spans.setRow(row, cells)
+	}
+}
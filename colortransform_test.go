@@ -0,0 +1,68 @@
+package scanx_test
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/srwiley/scanx"
+)
+
+func TestApplyColorTransform(t *testing.T) {
+	width, height := 200, 175
+	invert := func(v uint8) uint8 { return 0xFF - v }
+	for _, tc := range []struct {
+		name, file string
+		t          scanx.ColorTransform
+	}{
+		{"grayscale", "testdata/svg/landscapeIcons/mountains.svg", scanx.SaturateMatrix(0)},
+		{"tint", "testdata/svg/landscapeIcons/mountains.svg", scanx.ColorMatrix{{0.5, 0, 0, 0, 0.5}, {0, 0.5, 0, 0, 0.2}, {0, 0, 0.5, 0, 0}, {0, 0, 0, 0.8, 0}}},
+		{"invert", "testdata/svg/landscapeIcons/mountains.svg", scanx.ComponentTransfer{invert, invert, invert, nil}},
+		// the many short spans of rl.svg make rows of pixels
+		{"tint dense", "testdata/svg/rl.svg", scanx.ColorMatrix{{0.5, 0, 0, 0, 0.5}, {0, 0.5, 0, 0, 0.2}, {0, 0, 0.5, 0, 0}, {0, 0, 0, 0.8, 0}}},
+	} {
+		// transforming the spans gives the same pixels as transforming
+		// each pixel of the drawing
+		lspanner := RenderLinkList(t, tc.file, width, height, nil)
+		want := image.NewRGBA(image.Rect(0, 0, width, height))
+		lspanner.DrawToImage(want)
+		for i := 0; i < len(want.Pix); i += 4 {
+			p := want.Pix[i : i+4 : i+4]
+			c := tc.t.TransformRGBA(color.RGBA{p[0], p[1], p[2], p[3]})
+			p[0], p[1], p[2], p[3] = c.R, c.G, c.B, c.A
+		}
+		lspanner.ApplyColorTransform(tc.t)
+		img := image.NewRGBA(want.Rect)
+		lspanner.DrawToImage(img)
+		if d := MaxPixDiff(img, want); d != 0 {
+			t.Errorf("%s: transformed spans differ from transformed pixels by %d", tc.name, d)
+		}
+	}
+
+	// adjacent spans mapped to the same color are merged
+	red, blue, green := color.RGBA{0xFF, 0, 0, 0xFF}, color.RGBA{0, 0, 0xFF, 0xFF}, color.RGBA{0, 0x80, 0, 0x80}
+	lspanner := &scanx.LinkListSpanner{}
+	lspanner.SetBounds(image.Rect(0, 0, 40, 4))
+	fillRect(lspanner, red, image.Rect(2, 0, 12, 4))
+	fillRect(lspanner, blue, image.Rect(12, 0, 20, 4))
+	fillRect(lspanner, blue, image.Rect(24, 0, 30, 4))
+	lspanner.ApplyColorTransform(scanx.PaletteMap{red: green, blue: green})
+	var got []scanx.Span
+	for s := range lspanner.Spans(1) {
+		got = append(got, s)
+	}
+	want := []scanx.Span{{Y: 1, X0: 2, X1: 20, Color: green}, {Y: 1, X0: 24, X1: 30, Color: green}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("remapped row has spans %v, want %v", got, want)
+	}
+	// and the rows still take new spans
+	fillRect(lspanner, red, image.Rect(10, 1, 26, 2))
+	got = got[:0]
+	for s := range lspanner.Spans(1) {
+		got = append(got, s)
+	}
+	want = []scanx.Span{{Y: 1, X0: 2, X1: 10, Color: green}, {Y: 1, X0: 10, X1: 26, Color: red}, {Y: 1, X0: 26, X1: 30, Color: green}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("row has spans %v after drawing over merged spans, want %v", got, want)
+	}
+}
@@ -0,0 +1,159 @@
+package scanx
+
+import (
+	"image/color"
+	"image/draw"
+)
+
+// CompositeOp is a Porter-Duff compositing operator for the Composite
+// field of ImgSpanner, LinkListSpanner and Packed16Spanner. It is a type of
+// its own rather than a draw.Op, since image/draw only implements Over and
+// Src and would draw the other operators as Src.
+type CompositeOp uint8
+
+// The Porter-Duff operators. DrawOp, the zero value, selects the operator
+// in the Op field, which is SrcOver for draw.Over and Src otherwise.
+//
+// Except for Src, an operator applies with the span coverage ma as a shape
+// mask: the result is interpolated between the destination and the
+// composited value by ma. Src keeps its original behavior of replacing the
+// destination with the source scaled by ma.
+const (
+	DrawOp CompositeOp = iota
+	SrcOver
+	Src
+	Clear
+	Dst
+	DstOver
+	SrcIn
+	DstIn
+	SrcOut
+	DstOut
+	SrcAtop
+	DstAtop
+	Xor
+	Plus
+)
+
+// compositeOp returns the Porter-Duff operator of x, from Composite or
+// from Op if Composite is DrawOp.
+func (x *baseSpanner) compositeOp() CompositeOp {
+	switch {
+	case x.Composite != DrawOp:
+		return x.Composite
+	case x.Op == draw.Over:
+		return SrcOver
+	}
+	return Src
+}
+
+// porterDuffFactors returns the Fa and Fb factors of the operator op for the
+// source alpha sa and destination alpha da, all scaled to m.
+func porterDuffFactors(op CompositeOp, sa, da uint32) (fa, fb uint32) {
+	switch op {
+	case Clear:
+		return 0, 0
+	case Src:
+		return m, 0
+	case Dst:
+		return 0, m
+	case DstOver:
+		return m - da, m
+	case SrcIn:
+		return da, 0
+	case DstIn:
+		return 0, sa
+	case SrcOut:
+		return m - da, 0
+	case DstOut:
+		return 0, m - sa
+	case SrcAtop:
+		return da, m - sa
+	case DstAtop:
+		return m - da, sa
+	case Xor:
+		return m - da, m - sa
+	case Plus:
+		return m, m
+	default: // SrcOver
+		return m, m - sa
+	}
+}
+
+// compositeChannel returns s*fa + d*fb, clamped to m, interpolated from d
+// by the coverage ma.
+func compositeChannel(s, d, fa, fb, ma uint32) uint32 {
+	// the sum may exceed 32 bits for Plus
+	r := uint32((uint64(s)*uint64(fa) + uint64(d)*uint64(fb)) / m)
+	if r > m {
+		r = m
+	}
+	return (d*(m-ma) + r*ma) / m
+}
+
+// composite16 composites the premultiplied 16 bit source onto the
+// premultiplied 16 bit destination with the operator of x, after mixing the colors with
+// x.Blend, and with coverage ma. If x.LinearLight is set, the colors are
+// converted to linear light for the mixing and compositing.
+func (x *baseSpanner) composite16(sr, sg, sb, sa, dr, dg, db, da, ma uint32) (r, g, b, a uint32) {
+	if x.LinearLight {
+		sr, sg, sb = toLinear16(sr, sa), toLinear16(sg, sa), toLinear16(sb, sa)
+		dr, dg, db = toLinear16(dr, da), toLinear16(dg, da), toLinear16(db, da)
+	}
+	if x.Blend != BlendNormal {
+		sr, sg, sb = blend16(x.Blend, sr, sg, sb, sa, dr, dg, db, da)
+	}
+	if op := x.compositeOp(); op == Src {
+		r, g, b, a = sr*ma/m, sg*ma/m, sb*ma/m, sa*ma/m
+	} else {
+		fa, fb := porterDuffFactors(op, sa, da)
+		r, g, b, a = compositeChannel(sr, dr, fa, fb, ma),
+			compositeChannel(sg, dg, fa, fb, ma),
+			compositeChannel(sb, db, fa, fb, ma),
+			compositeChannel(sa, da, fa, fb, ma)
+	}
+	if x.LinearLight {
+		r, g, b = fromLinear16(r, a), fromLinear16(g, a), fromLinear16(b, a)
+	}
+	return
+}
+
+// compositeRGBA composites src onto dst with coverage ma.
+func (x *baseSpanner) compositeRGBA(src, dst color.RGBA, ma uint32) color.RGBA {
+	r, g, b, a := x.composite16(
+		uint32(src.R)*pa, uint32(src.G)*pa, uint32(src.B)*pa, uint32(src.A)*pa,
+		uint32(dst.R)*pa, uint32(dst.G)*pa, uint32(dst.B)*pa, uint32(dst.A)*pa, ma)
+	return color.RGBA{to8(r), to8(g), to8(b), to8(a)}
+}
+
+// compositeRGBA16 composites the premultiplied 16 bit source onto dst with
+// coverage ma.
+func (x *baseSpanner) compositeRGBA16(sr, sg, sb, sa uint32, dst color.RGBA, ma uint32) color.RGBA {
+	r, g, b, a := x.composite16(sr, sg, sb, sa,
+		uint32(dst.R)*pa, uint32(dst.G)*pa, uint32(dst.B)*pa, uint32(dst.A)*pa, ma)
+	return color.RGBA{to8(r), to8(g), to8(b), to8(a)}
+}
+
+// compositePix composites the premultiplied 16 bit source onto the 4 byte
+// pixel at pix[i] with coverage ma. If bgr is set, the red and blue channels
+// of the source and the pixel are swapped, as in an xgraphics.Image, and are
+// put back in order for compositing, since the non-separable blend modes
+// weight the channels differently.
+func (x *baseSpanner) compositePix(pix []uint8, i int, sr, sg, sb, sa, ma uint32, bgr bool) {
+	ir, ib := i, i+2
+	if bgr {
+		sr, sb = sb, sr
+		ir, ib = ib, ir
+	}
+	r, g, b, a := x.composite16(sr, sg, sb, sa,
+		uint32(pix[ir])*pa, uint32(pix[i+1])*pa, uint32(pix[ib])*pa, uint32(pix[i+3])*pa, ma)
+	pix[ir] = to8(r)
+	pix[i+1] = to8(g)
+	pix[ib] = to8(b)
+	pix[i+3] = to8(a)
+}
+
+// to8 rounds a 16 bit channel value to 8 bits.
+func to8(v uint32) uint8 {
+	return uint8((v + 0x80) / pa)
+}
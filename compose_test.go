@@ -0,0 +1,204 @@
+package scanx_test
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+
+	"github.com/srwiley/scanx"
+)
+
+var porterDuffOps = []scanx.CompositeOp{scanx.Clear, scanx.Src, scanx.Dst, scanx.SrcOver,
+	scanx.DstOver, scanx.SrcIn, scanx.DstIn, scanx.SrcOut, scanx.DstOut,
+	scanx.SrcAtop, scanx.DstAtop, scanx.Xor, scanx.Plus}
+
+// referencePorterDuff returns the premultiplied channel value, in [0, 1], of
+// compositing s onto d with op at coverage cov.
+func referencePorterDuff(op scanx.CompositeOp, s, sa, d, da, cov float64) float64 {
+	var fa, fb float64
+	switch op {
+	case scanx.Clear:
+	case scanx.Src:
+		return s * cov
+	case scanx.Dst:
+		fb = 1
+	case scanx.SrcOver:
+		fa, fb = 1, 1-sa
+	case scanx.DstOver:
+		fa, fb = 1-da, 1
+	case scanx.SrcIn:
+		fa = da
+	case scanx.DstIn:
+		fb = sa
+	case scanx.SrcOut:
+		fa = 1 - da
+	case scanx.DstOut:
+		fb = 1 - sa
+	case scanx.SrcAtop:
+		fa, fb = da, 1-sa
+	case scanx.DstAtop:
+		fa, fb = 1-da, sa
+	case scanx.Xor:
+		fa, fb = 1-da, 1-sa
+	case scanx.Plus:
+		fa, fb = 1, 1
+	}
+	return d + (math.Min(s*fa+d*fb, 1)-d)*cov
+}
+
+// checkComposite compares got against the reference result of compositing src onto dst.
+func checkComposite(t *testing.T, name string, op scanx.CompositeOp, src, dst, got color.RGBA, cov uint32) {
+	t.Helper()
+	sa, da, fc := float64(src.A)/255, float64(dst.A)/255, float64(cov)/0xFFFF
+	want := [4]float64{
+		referencePorterDuff(op, float64(src.R)/255, sa, float64(dst.R)/255, da, fc),
+		referencePorterDuff(op, float64(src.G)/255, sa, float64(dst.G)/255, da, fc),
+		referencePorterDuff(op, float64(src.B)/255, sa, float64(dst.B)/255, da, fc),
+		referencePorterDuff(op, sa, sa, da, da, fc)}
+	for k, v := range [4]uint8{got.R, got.G, got.B, got.A} {
+		if d := float64(v) - want[k]*255; d < -2 || d > 2 {
+			t.Errorf("%s op %d: %v onto %v at coverage %#x gave %v, want %v",
+				name, op, src, dst, cov, got, want)
+			return
+		}
+	}
+}
+
+func TestPorterDuffReference(t *testing.T) {
+	colors := []color.RGBA{
+		{0, 0, 0, 0},
+		{0xFF, 0x80, 0x00, 0xFF},
+		{0x10, 0x40, 0x60, 0x80},
+		{0x00, 0xC0, 0x20, 0xE0},
+	}
+	bounds := image.Rect(0, 0, 1, 1)
+	for _, op := range porterDuffOps {
+		for _, src := range colors {
+			for _, dst := range colors {
+				for _, cov := range []uint32{0xFFFF, 0x8000, 0x1234} {
+					img := image.NewRGBA(bounds)
+					img.SetRGBA(0, 0, dst)
+					spanner := scanx.NewImgSpanner(img)
+					spanner.Composite = op
+					spanner.SetColor(src)
+					spanner.GetSpanFunc()(0, 0, 1, cov)
+					checkComposite(t, "ImgSpanner", op, src, dst, img.RGBAAt(0, 0), cov)
+
+					img.SetRGBA(0, 0, color.RGBA{})
+					lspanner := &scanx.LinkListSpanner{}
+					lspanner.SetBounds(bounds)
+					lspanner.Composite = op
+					lspanner.SetBgColor(dst)
+					lspanner.SetColor(src)
+					lspanner.GetSpanFunc()(0, 0, 1, cov)
+					lspanner.DrawToImage(img)
+					checkComposite(t, "LinkListSpanner", op, src, dst, img.RGBAAt(0, 0), cov)
+				}
+			}
+		}
+	}
+}
+
+func TestPorterDuffSpanners(t *testing.T) {
+	width := 200
+	height := 175
+
+	img1 := image.NewRGBA(image.Rect(0, 0, width, height))
+	img2 := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	svgs, err := FilePathWalkDir("testdata/svg/landscapeIcons")
+	if err != nil {
+		t.Fatal("cannot walk file path testdata/svg/landscapeIcons")
+	}
+	for _, op := range porterDuffOps {
+		for _, f := range svgs {
+			Clear(img1)
+			Clear(img2)
+			RenderLinkList(t, f, width, height, func(s *scanx.LinkListSpanner) {
+				s.Composite = op
+			}).DrawToImage(img1)
+			RenderImg(t, f, img2, func(s *scanx.ImgSpanner) {
+				s.Composite = op
+			})
+			if d := MaxPixDiff(img1, img2); d != 0 {
+				t.Errorf("%s op %d: spanners differ by %d", f, op, d)
+			}
+		}
+	}
+
+	// Composite overrides Op, and draw.Src selects Src while Composite is DrawOp
+	f := "testdata/svg/landscapeIcons/sea.svg"
+	for _, tc := range []struct {
+		op        draw.Op
+		composite scanx.CompositeOp
+		want      scanx.CompositeOp
+	}{{draw.Src, scanx.DrawOp, scanx.Src}, {draw.Src, scanx.SrcOver, scanx.SrcOver}, {draw.Over, scanx.Xor, scanx.Xor}} {
+		Clear(img1)
+		Clear(img2)
+		RenderImg(t, f, img1, func(s *scanx.ImgSpanner) {
+			s.Op, s.Composite = tc.op, tc.composite
+		})
+		RenderImg(t, f, img2, func(s *scanx.ImgSpanner) {
+			s.Composite = tc.want
+		})
+		if d := MaxPixDiff(img1, img2); d != 0 {
+			t.Errorf("Op %d with Composite %d differs from Composite %d by %d", tc.op, tc.composite, tc.want, d)
+		}
+	}
+}
+
+func TestOpacity(t *testing.T) {
+	bounds := image.Rect(0, 0, 4, 1)
+	red := color.RGBA{0xFF, 0, 0, 0xFF}
+	for _, tc := range []struct {
+		opacity float64
+		want    color.RGBA
+	}{
+		{1, red},
+		{0.5, color.RGBA{0x80, 0, 0, 0x80}},
+		{0.25, color.RGBA{0x40, 0, 0, 0x40}},
+		{0, color.RGBA{}},
+	} {
+		img := image.NewRGBA(bounds)
+		spanner := scanx.NewImgSpanner(img)
+		spanner.SetOpacity(tc.opacity)
+		spanner.SetColor(red)
+		spanner.GetSpanFunc()(0, 0, 4, 0xFFFF)
+		if got := img.RGBAAt(2, 0); got != tc.want {
+			t.Errorf("ImgSpanner opacity %v gave %v, want %v", tc.opacity, got, tc.want)
+		}
+
+		lspanner := &scanx.LinkListSpanner{}
+		lspanner.SetBounds(bounds)
+		lspanner.SetOpacity(tc.opacity)
+		lspanner.SetColor(red)
+		lspanner.GetSpanFunc()(0, 0, 4, 0xFFFF)
+		Clear(img)
+		lspanner.DrawToImage(img)
+		if got := img.RGBAAt(2, 0); got != tc.want {
+			t.Errorf("LinkListSpanner opacity %v gave %v, want %v", tc.opacity, got, tc.want)
+		}
+	}
+
+	width, height := 200, 175
+	img1 := image.NewRGBA(image.Rect(0, 0, width, height))
+	img2 := image.NewRGBA(image.Rect(0, 0, width, height))
+	for _, op := range []scanx.CompositeOp{scanx.SrcOver, scanx.Src, scanx.Xor} {
+		Clear(img1)
+		Clear(img2)
+		file := "testdata/svg/landscapeIcons/mountains.svg"
+		RenderLinkList(t, file, width, height, func(s *scanx.LinkListSpanner) {
+			s.Composite = op
+			s.SetOpacity(0.6)
+		}).DrawToImage(img1)
+		RenderImg(t, file, img2, func(s *scanx.ImgSpanner) {
+			s.Composite = op
+			s.SetOpacity(0.6)
+		})
+		if d := MaxPixDiff(img1, img2); d != 0 {
+			t.Errorf("op %d: spanners differ by %d", op, d)
+		}
+	}
+}
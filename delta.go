@@ -0,0 +1,240 @@
+package scanx
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+)
+
+const (
+	deltaMagic   = "SXDL"
+	deltaVersion = 1
+	// rectGap is the number of unchanged pixels between the runs of a row
+	// above which they are put into separate dirty rectangles.
+	rectGap = 16
+)
+
+// A Delta holds the pixels that changed from one frame drawn by a
+// LinkListSpanner to the next, such as an update for a remote display. The
+// pixels of a frame are those that DrawToImage writes onto a transparent
+// image, so pixels that no span covers are transparent.
+type Delta struct {
+	// Bounds are the bounds of the next frame.
+	Bounds image.Rectangle
+	// Runs are the changed pixels with their colors in the next frame, from
+	// top to bottom and left to right. Adjacent changed pixels of the same
+	// color are in a single run.
+	Runs []Span
+	// Rects cover all of the Runs, as the areas to repaint. Runs that are
+	// close together on consecutive rows share a rectangle.
+	Rects []image.Rectangle
+}
+
+// Diff returns the changes from the frame in prev to the frame in next,
+// within the bounds of next. If prev is nil, or its bounds differ, the
+// pixels outside of its bounds are taken to be transparent.
+func Diff(prev, next *LinkListSpanner) *Delta {
+	d := &Delta{Bounds: next.bounds}
+	var a, b []Span
+	for y := next.bounds.Min.Y; y < next.bounds.Max.Y; y++ {
+		a, b = a[:0], b[:0]
+		if prev != nil {
+			for s := range prev.Spans(y) {
+				a = append(a, s)
+			}
+		}
+		for s := range next.Spans(y) {
+			b = append(b, s)
+		}
+		d.Runs = diffRow(d.Runs, y, next.bounds.Min.X, next.bounds.Max.X, a, b)
+	}
+	d.Rects = dirtyRects(d.Runs)
+	return d
+}
+
+// colorAt returns the color of the spans at x, which is transparent if no
+// span covers x, and the column at which that color may change. The spans
+// before index i end at or before x, and the returned index is the first
+// span that does not.
+func colorAt(spans []Span, i, x, end int) (c color.RGBA, next, j int) {
+	for i < len(spans) && spans[i].X1 <= x {
+		i++
+	}
+	if i < len(spans) {
+		if spans[i].X0 <= x {
+			return spans[i].Color, min(end, spans[i].X1), i
+		}
+		return c, min(end, spans[i].X0), i
+	}
+	return c, end, i
+}
+
+// diffRow appends to runs the pixels of row y from x0 to x1 whose colors
+// differ between the spans a and b, with the colors of b.
+func diffRow(runs []Span, y, x0, x1 int, a, b []Span) []Span {
+	i, j := 0, 0
+	for x := x0; x < x1; {
+		ca, end, ni := colorAt(a, i, x, x1)
+		cb, end, nj := colorAt(b, j, x, end)
+		i, j = ni, nj
+		if ca != cb {
+			if k := len(runs) - 1; k >= 0 && runs[k].Y == y && runs[k].X1 == x && runs[k].Color == cb {
+				runs[k].X1 = end
+			} else {
+				runs = append(runs, Span{Y: y, X0: x, X1: end, Color: cb})
+			}
+		}
+		x = end
+	}
+	return runs
+}
+
+// dirtyRects returns rectangles covering runs. The runs of a row are grouped
+// into clusters separated by more than rectGap pixels, and a cluster extends
+// the rectangle of the row above that it overlaps.
+func dirtyRects(runs []Span) (rects []image.Rectangle) {
+	open := 0 // rects[open:] may be extended by the current row
+	for k := 0; k < len(runs); {
+		y := runs[k].Y
+		rowStart := len(rects)
+		for k < len(runs) && runs[k].Y == y {
+			c := image.Rect(runs[k].X0, y, runs[k].X1, y+1)
+			for k++; k < len(runs) && runs[k].Y == y && runs[k].X0-c.Max.X <= rectGap; k++ {
+				c.Max.X = runs[k].X1
+			}
+			merged := false
+			for i := open; i < rowStart; i++ {
+				r := rects[i]
+				if r.Max.Y == y && r.Min.X < c.Max.X && c.Min.X < r.Max.X {
+					rects[i] = r.Union(c)
+					merged = true
+					break
+				}
+			}
+			if !merged {
+				rects = append(rects, c)
+			}
+		}
+		// only the rects reaching this row can be extended by the next one
+		for open < len(rects) && rects[open].Max.Y < y+1 {
+			open++
+		}
+	}
+	return rects
+}
+
+// ApplyDelta writes the changed pixels of d onto img, which then holds the
+// next frame if it held the previous one. Pixels outside of the bounds of
+// img are skipped.
+func ApplyDelta(img *image.RGBA, d *Delta) {
+	b := img.Bounds()
+	for _, s := range d.Runs {
+		if s.Y < b.Min.Y || s.Y >= b.Max.Y {
+			continue
+		}
+		x0, x1 := max(s.X0, b.Min.X), min(s.X1, b.Max.X)
+		if x0 >= x1 {
+			continue
+		}
+		i := img.PixOffset(x0, s.Y)
+		c := s.Color
+		for row := img.Pix[i : i+(x1-x0)*4]; len(row) >= 4; row = row[4:] {
+			row[0], row[1], row[2], row[3] = c.R, c.G, c.B, c.A
+		}
+	}
+}
+
+// WriteTo writes d to w in a versioned binary format like that of
+// LinkListSpanner.WriteTo, with only the changed rows. The Rects are not
+// written, since ReadFrom computes them from the Runs. It returns the number
+// of bytes written.
+func (d *Delta) WriteTo(w io.Writer) (int64, error) {
+	palette, colors := spanPalette(func(yield func(Span) bool) {
+		for _, s := range d.Runs {
+			if !yield(s) {
+				return
+			}
+		}
+	})
+	buf := append([]byte(deltaMagic), deltaVersion)
+	buf = appendBounds(buf, d.Bounds)
+	buf = appendPalette(buf, colors)
+	rows := 0
+	for k := range d.Runs {
+		if k == 0 || d.Runs[k].Y != d.Runs[k-1].Y {
+			rows++
+		}
+	}
+	buf = binary.AppendUvarint(buf, uint64(rows))
+	nextY := d.Bounds.Min.Y
+	for k := 0; k < len(d.Runs); {
+		y, start := d.Runs[k].Y, k
+		for k < len(d.Runs) && d.Runs[k].Y == y {
+			k++
+		}
+		buf = binary.AppendUvarint(buf, uint64(y-nextY))
+		buf = appendRow(buf, d.Runs[start:k], d.Bounds.Min.X, palette)
+		nextY = y + 1
+	}
+	n, err := w.Write(buf)
+	return int64(n), err
+}
+
+// ReadFrom replaces d with a delta written by WriteTo. If r is not an
+// io.ByteReader, it is buffered and may be read past the end of the delta.
+// It returns the number of bytes read, and ErrSpanFormat or ErrSpanVersion
+// if the delta is not valid, in which case d is unchanged.
+func (d *Delta) ReadFrom(r io.Reader) (int64, error) {
+	cr := newCountingReader(r)
+	nd, err := readDelta(cr)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return cr.n, err
+	}
+	*d = *nd
+	return cr.n, nil
+}
+
+func readDelta(r *countingReader) (*Delta, error) {
+	if err := readHeader(r, deltaMagic, deltaVersion); err != nil {
+		return nil, err
+	}
+	bounds, err := readBounds(r)
+	if err != nil {
+		return nil, err
+	}
+	colors, err := readPalette(r)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if rows > uint64(bounds.Dy()) {
+		return nil, ErrSpanFormat
+	}
+	d := &Delta{Bounds: bounds}
+	y := bounds.Min.Y
+	for ; rows > 0; rows-- {
+		gap, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if gap >= uint64(bounds.Max.Y-y) {
+			return nil, ErrSpanFormat
+		}
+		y += int(gap)
+		row, err := readRow(r, y, bounds, colors)
+		if err != nil {
+			return nil, err
+		}
+		d.Runs = append(d.Runs, row...)
+		y++
+	}
+	d.Rects = dirtyRects(d.Runs)
+	return d, nil
+}
@@ -0,0 +1,100 @@
+package scanx_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io"
+	"testing"
+
+	"github.com/srwiley/scanx"
+)
+
+// checkDelta diffs prev and next, sends the delta through its stream and
+// applies it to a drawing of prev, which must then match a drawing of next.
+func checkDelta(t *testing.T, name string, prev, next *scanx.LinkListSpanner) *scanx.Delta {
+	t.Helper()
+	d := scanx.Diff(prev, next)
+	var buf bytes.Buffer
+	n, err := d.WriteTo(&buf)
+	if err != nil || n != int64(buf.Len()) {
+		t.Fatalf("%s: WriteTo wrote %d of %d bytes: %v", name, n, buf.Len(), err)
+	}
+	var got scanx.Delta
+	if _, err := got.ReadFrom(struct{ io.Reader }{&buf}); err != nil {
+		t.Fatalf("%s: cannot read delta: %v", name, err)
+	}
+	if got.Bounds != d.Bounds || len(got.Runs) != len(d.Runs) || len(got.Rects) != len(d.Rects) {
+		t.Fatalf("%s: read delta with %d runs and %d rects, want %d and %d", name, len(got.Runs), len(got.Rects), len(d.Runs), len(d.Rects))
+	}
+
+	img := image.NewRGBA(next.Bounds())
+	if prev != nil {
+		prev.DrawToImage(img)
+	}
+	scanx.ApplyDelta(img, &got)
+	want := image.NewRGBA(next.Bounds())
+	next.DrawToImage(want)
+	if d := MaxPixDiff(img, want); d != 0 {
+		t.Errorf("%s: applied delta differs from a full drawing by %d", name, d)
+	}
+	for _, s := range got.Runs {
+		covered := false
+		for _, r := range got.Rects {
+			covered = covered || image.Rect(s.X0, s.Y, s.X1, s.Y+1).In(r)
+		}
+		if !covered {
+			t.Errorf("%s: run %v is not in a dirty rectangle", name, s)
+			break
+		}
+	}
+	return d
+}
+
+func TestDiff(t *testing.T) {
+	width, height := 200, 175
+	mountains := RenderLinkList(t, "testdata/svg/landscapeIcons/mountains.svg", width, height, nil)
+	sea := RenderLinkList(t, "testdata/svg/landscapeIcons/sea.svg", width, height, nil)
+	checkDelta(t, "mountains to sea", mountains, sea)
+	checkDelta(t, "first frame", nil, sea)
+	if d := checkDelta(t, "same frame", sea, sea); len(d.Runs) != 0 || len(d.Rects) != 0 {
+		t.Errorf("same frame gave %d runs and %d rects", len(d.Runs), len(d.Rects))
+	}
+
+	// a small change only gives runs and rects around it
+	var buf bytes.Buffer
+	mountains.WriteTo(&buf)
+	changed, err := scanx.ReadLinkListSpanner(&buf)
+	if err != nil {
+		t.Fatal("cannot copy spans:", err)
+	}
+	spot := image.Rect(20, 30, 28, 36)
+	fillRect(changed, color.RGBA{0x20, 0x80, 0x20, 0xFF}, spot)
+	d := checkDelta(t, "small change", mountains, changed)
+	if len(d.Rects) != 1 || !d.Rects[0].In(spot) {
+		t.Errorf("small change gave rects %v, want one in %v", d.Rects, spot)
+	}
+
+	// frames of different bounds
+	moved := &scanx.LinkListSpanner{}
+	moved.SetBounds(image.Rect(-10, 5, 60, 40))
+	fillRect(moved, color.RGBA{0, 0, 0x80, 0x80}, image.Rect(-10, 10, 30, 20))
+	checkDelta(t, "different bounds", sea, moved)
+
+	// corrupt deltas are rejected
+	for _, tc := range []struct {
+		data []byte
+		err  error
+	}{
+		{[]byte("SXRL\x01"), scanx.ErrSpanFormat},
+		{[]byte("SXDL\x02"), scanx.ErrSpanVersion},
+		{[]byte("SXDL\x01\x00\x00\x02\x02\x01\x01\x02\x03\x03\x03\x01"), scanx.ErrSpanFormat},                 // more rows than the bounds
+		{[]byte("SXDL\x01\x00\x00\x02\x02\x01\x01\x02\x03\x03\x01\x02\x01\x00\x00\x00"), scanx.ErrSpanFormat}, // row past the bounds
+		{[]byte("SXDL\x01\x00\x00\x02\x02\x01\x01\x02\x03\x03\x01\x01\x01"), io.ErrUnexpectedEOF},
+	} {
+		var d scanx.Delta
+		if _, err := d.ReadFrom(bytes.NewReader(tc.data)); err != tc.err {
+			t.Errorf("reading % x gave %v, want %v", tc.data, err, tc.err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package scanx
+
+// DitherMode selects how span colors are quantized when they are written
+// to image types with fewer bits per channel than color.RGBA.
+type DitherMode int
+
+const (
+	// NoDither rounds each channel to the nearest representable value.
+	NoDither DitherMode = iota
+	// OrderedDither applies a 4x4 Bayer threshold matrix before quantizing.
+	OrderedDither
+	// FloydSteinberg diffuses the quantization error of each pixel onto its
+	// unvisited neighbors. It applies only to whole-image targets like *Bitmap.
+	FloydSteinberg
+	// Atkinson diffuses three quarters of the quantization error over a
+	// wider neighborhood, giving higher contrast than FloydSteinberg.
+	Atkinson
+)
+
+// bayer4 is the 4x4 ordered dithering threshold matrix with values 0-15.
+var bayer4 = [4][4]uint32{
+	{0, 8, 2, 10},
+	{12, 4, 14, 6},
+	{3, 11, 1, 9},
+	{15, 7, 13, 5},
+}
+
+const (
+	// quantScale is the denominator used by quantize; 16 Bayer levels
+	// times the 255 8-bit range.
+	quantScale = 16 * 255
+	// roundBias makes quantize round to nearest.
+	roundBias = quantScale / 2
+)
+
+// ditherBias returns the quantize bias for pixel (x, y) under mode d.
+func ditherBias(d DitherMode, x, y int) uint32 {
+	if d == OrderedDither {
+		return bayer4[y&3][x&3]*255 + 128
+	}
+	return roundBias
+}
+
+// ditherRow fills biases with the quantize bias for the four x phases of row y.
+func ditherRow(d DitherMode, y int, biases *[4]uint32) {
+	for i := range biases {
+		biases[i] = ditherBias(d, i, y)
+	}
+}
+
+// quantize maps the 8-bit value v onto levels steps, 0 to levels-1. The
+// bias is roundBias for rounding, or a per-pixel dither threshold.
+func quantize(v, levels, bias uint32) uint32 {
+	return (v*(levels-1)*16 + bias) / quantScale
+}
@@ -0,0 +1,90 @@
+package scanx_test
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/srwiley/scanx"
+)
+
+// backdrop returns an image of a smooth photo like background.
+func backdrop(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x * 255 / width), uint8(y * 255 / height), 0x90, 0xFF})
+		}
+	}
+	return img
+}
+
+func TestDrawOverImage(t *testing.T) {
+	width, height := 200, 175
+	for _, file := range []string{
+		"testdata/svg/landscapeIcons/mountains.svg",
+		"testdata/svg/landscapeIcons/sea.svg",
+	} {
+		img1 := backdrop(width, height)
+		RenderImg(t, file, img1, nil)
+
+		img2 := backdrop(width, height)
+		lspanner := RenderLinkList(t, file, width, height, nil)
+		lspanner.DrawOverImage(img2)
+		// span colors are rounded to 8 bits each time they are composited,
+		// so overlapping semitransparent paths may drift by a few levels
+		if d := MaxPixDiff(img1, img2); d > 4 {
+			t.Errorf("%s: DrawOverImage differs from drawing directly by %d", file, d)
+		}
+
+		// the general path for other image types
+		img3 := image.NewNRGBA(img2.Rect)
+		draw.Draw(img3, img3.Rect, backdrop(width, height), image.Point{}, draw.Src)
+		lspanner.DrawOverImage(img3)
+		img4 := image.NewRGBA(img2.Rect)
+		draw.Draw(img4, img4.Rect, img3, image.Point{}, draw.Src)
+		if d := MaxPixDiff(img2, img4); d > 1 {
+			t.Errorf("%s: DrawOverImage of *image.NRGBA differs by %d", file, d)
+		}
+	}
+
+	// an opaque bgColor fills the covered pixels before the paths are drawn,
+	// as if the paths were drawn onto the bgColor
+	bg := color.RGBA{0x30, 0x20, 0x10, 0xFF}
+	file := "testdata/svg/landscapeIcons/mountains.svg"
+	onBg := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(onBg, onBg.Rect, image.NewUniform(bg), image.Point{}, draw.Src)
+	RenderImg(t, file, onBg, nil)
+	lspanner := RenderLinkList(t, file, width, height, func(s *scanx.LinkListSpanner) { s.SetBgColor(bg) })
+	spans := image.NewRGBA(onBg.Rect)
+	lspanner.DrawToImage(spans)
+	want := backdrop(width, height)
+	for i := 0; i < len(want.Pix); i += 4 {
+		if spans.Pix[i+3] != 0 {
+			copy(want.Pix[i:i+4], onBg.Pix[i:i+4])
+		}
+	}
+	img := backdrop(width, height)
+	lspanner.DrawOverImage(img)
+	if d := MaxPixDiff(img, want); d > 4 {
+		t.Errorf("DrawOverImage with an opaque bgColor differs by %d", d)
+	}
+
+	// uncovered pixels are left unchanged
+	bounds := image.Rect(0, 0, 8, 2)
+	img = backdrop(8, 2)
+	lspanner = &scanx.LinkListSpanner{}
+	lspanner.SetBounds(bounds)
+	lspanner.SetColor(color.RGBA{0, 0, 0x80, 0x80})
+	lspanner.GetSpanFunc()(0, 2, 6, 0xFFFF)
+	lspanner.DrawOverImage(img)
+	want = backdrop(8, 2)
+	if got := img.RGBAAt(7, 0); got != want.RGBAAt(7, 0) {
+		t.Errorf("uncovered pixel is %v, want %v", got, want.RGBAAt(7, 0))
+	}
+	under := want.RGBAAt(3, 0)
+	if got := img.RGBAAt(3, 0); got.B != 0x80+under.B/2 || got.A != 0xFF {
+		t.Errorf("covered pixel is %v over %v", got, under)
+	}
+}
@@ -0,0 +1,145 @@
+package scanx
+
+import (
+	"image"
+	"image/color"
+)
+
+type (
+	// linkCell is a cell of the rows of a BaselineSpanner, linked to the
+	// next cell of its row by index.
+	linkCell struct {
+		x0, x1, next int
+		clr          color.RGBA
+	}
+
+	// BaselineSpanner adds spans to rows kept as the singly linked lists
+	// that LinkListSpanner used before its rows were indexed, with the
+	// colors, settings and span wrappers of the LinkListSpanner it embeds,
+	// so tests can check that the indexed rows give the same pixels.
+	BaselineSpanner struct {
+		*LinkListSpanner
+		cells        []linkCell // the first cells are the sentinels of the rows
+		lastY, lastP int
+	}
+)
+
+// NewBaselineSpanner returns a BaselineSpanner with the bounds.
+func NewBaselineSpanner(bounds image.Rectangle) *BaselineSpanner {
+	x := &BaselineSpanner{LinkListSpanner: &LinkListSpanner{}}
+	x.SetBounds(bounds)
+	x.cells = make([]linkCell, bounds.Dy())
+	return x
+}
+
+// GetSpanFunc returns the function that consumes a span described by the parameters.
+func (x *BaselineSpanner) GetSpanFunc() SpanFunc {
+	x.lastY = -1
+	if x.paint != nil {
+		return x.withClip(x.withOpacity(x.SpanPaint))
+	}
+	return x.withClip(x.withOpacity(x.SpanOver))
+}
+
+// SpanPaint adds the span in runs of pixels of the same paint color.
+func (x *BaselineSpanner) SpanPaint(yi, xi0, xi1 int, ma uint32) {
+	run := xi0
+	var clr color.RGBA
+	for i, c := range x.paintSpan(yi, xi0, xi1) {
+		c8 := color.RGBA{uint8(c.R >> 8), uint8(c.G >> 8), uint8(c.B >> 8), uint8(c.A >> 8)}
+		if i == 0 {
+			clr = c8
+		} else if c8 != clr {
+			x.fgColor = clr
+			x.SpanOver(yi, run, xi0+i, ma)
+			run, clr = xi0+i, c8
+		}
+	}
+	x.fgColor = clr
+	x.SpanOver(yi, run, xi1, ma)
+}
+
+// addLink adds a cell of underColor blended with alpha after cell pp, or
+// extends pp if it is adjacent and of the same color.
+func (x *BaselineSpanner) addLink(x0, x1, next, pp int, underColor color.RGBA, alpha uint32) (p int) {
+	clr := x.blendColor(underColor, alpha)
+	if prev := &x.cells[pp]; pp >= x.bounds.Dy() && prev.x1 >= x0 && ((clr.A == 0 && prev.clr.A == 0) || clr == prev.clr) {
+		prev.x1 = x1
+		return pp
+	}
+	p = len(x.cells)
+	x.cells = append(x.cells, linkCell{x0: x0, x1: x1, next: next, clr: clr})
+	x.cells[pp].next = p
+	return
+}
+
+// SpanOver adds the span by walking its row from the last cell changed.
+func (x *BaselineSpanner) SpanOver(yi, xi0, xi1 int, ma uint32) {
+	row := yi - x.bounds.Min.Y
+	if yi != x.lastY {
+		x.lastP = row
+		x.lastY = yi
+	}
+	pp := x.lastP
+	p := x.cells[pp].next
+	for p != 0 && xi0 < xi1 {
+		sp := x.cells[p]
+		if sp.x1 <= xi0 {
+			pp = p
+			p = sp.next
+			continue
+		}
+		if sp.x0 >= xi1 {
+			x.lastP = x.addLink(xi0, xi1, p, pp, x.bgColor, ma)
+			return
+		}
+		if xi0 < sp.x0 {
+			pp = x.addLink(xi0, sp.x0, p, pp, x.bgColor, ma)
+			xi0 = sp.x0
+		} else if xi0 > sp.x0 {
+			pp = x.addLink(sp.x0, xi0, p, pp, sp.clr, 0)
+		}
+		clr := x.blendColor(sp.clr, ma)
+		prev := x.cells[pp]
+		sameClrs := pp >= x.bounds.Dy() && ((clr.A == 0 && prev.clr.A == 0) || clr == prev.clr)
+		if xi1 < sp.x1 {
+			if prev.x1 >= xi0 && sameClrs {
+				x.cells[pp].x1, x.cells[pp].next = xi1, sp.next
+				x.lastP = row
+				p = pp
+			} else {
+				x.cells[p] = linkCell{x0: xi0, x1: xi1, next: sp.next, clr: clr}
+				x.lastP = pp
+			}
+			x.addLink(xi1, sp.x1, sp.next, p, sp.clr, 0)
+			return
+		}
+		if prev.x1 >= xi0 && sameClrs {
+			x.cells[pp].x1, x.cells[pp].next = sp.x1, sp.next
+			p = sp.next
+			xi0 = sp.x1
+			continue
+		}
+		x.cells[p] = linkCell{x0: xi0, x1: sp.x1, next: sp.next, clr: clr}
+		xi0 = sp.x1
+		pp = p
+		p = sp.next
+	}
+	x.lastP = pp
+	if xi0 < xi1 {
+		x.addLink(xi0, xi1, 0, pp, x.bgColor, ma)
+	}
+}
+
+// DrawToImage writes the cells onto img, which has the bounds of x.
+func (x *BaselineSpanner) DrawToImage(img *image.RGBA) {
+	for row := 0; row < x.bounds.Dy(); row++ {
+		y := row + x.bounds.Min.Y
+		for p := x.cells[row].next; p != 0; p = x.cells[p].next {
+			c := x.cells[p]
+			for cx := c.x0; cx < c.x1; cx++ {
+				img.SetRGBA(cx, y, c.clr)
+			}
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package scanx
+
+import (
+	"image/color"
+	"math"
+	"sort"
+
+	"github.com/srwiley/rasterx"
+)
+
+// gradientLUTSize is the number of entries in the color lookup table of a gradient.
+const gradientLUTSize = 1024
+
+type (
+	// Gradient holds the parts common to the gradient paints: the color
+	// stops, the spread method applied outside of the [0, 1] range of the
+	// gradient, and the transform from gradient space to the pixel space of
+	// the spanner. The color lookup table and the inverse transform are
+	// computed for a private copy of the gradient when it is passed to
+	// SetColor, so changes to the fields take effect at the next SetColor,
+	// and one gradient may be set on spanners in several goroutines. Calling
+	// FillSpan directly computes them in the gradient itself on first use,
+	// after which it must not be changed or used by several goroutines.
+	Gradient struct {
+		// Stops are the colors along the gradient. The premultiplied stop
+		// color is scaled by the stop Opacity, so a stop Opacity of 0 is
+		// transparent.
+		Stops  []rasterx.GradStop
+		Spread rasterx.SpreadMethod
+		Matrix rasterx.Matrix2D
+		lut    []color.RGBA64
+		inv    rasterx.Matrix2D
+	}
+
+	// LinearGradient varies the color along the line from (X1, Y1) to (X2, Y2).
+	LinearGradient struct {
+		Gradient
+		X1, Y1, X2, Y2 float64
+	}
+
+	// RadialGradient varies the color from the focal point (Fx, Fy) to the
+	// circle of radius R centered on (Cx, Cy), as for an SVG radialGradient.
+	// A focal point outside of the circle is moved onto it.
+	RadialGradient struct {
+		Gradient
+		Cx, Cy, R, Fx, Fy float64
+		fx, fy            float64
+	}
+
+	// ConicGradient varies the color with the angle around (Cx, Cy),
+	// starting at Angle radians and increasing clockwise in pixel space.
+	ConicGradient struct {
+		Gradient
+		Cx, Cy, Angle float64
+	}
+)
+
+// NewLinearGradient returns a LinearGradient with pad spread and the identity transform.
+func NewLinearGradient(x1, y1, x2, y2 float64, stops ...rasterx.GradStop) *LinearGradient {
+	return &LinearGradient{Gradient: Gradient{Stops: stops, Matrix: rasterx.Identity},
+		X1: x1, Y1: y1, X2: x2, Y2: y2}
+}
+
+// NewRadialGradient returns a RadialGradient with pad spread and the identity transform.
+func NewRadialGradient(cx, cy, r, fx, fy float64, stops ...rasterx.GradStop) *RadialGradient {
+	return &RadialGradient{Gradient: Gradient{Stops: stops, Matrix: rasterx.Identity},
+		Cx: cx, Cy: cy, R: r, Fx: fx, Fy: fy}
+}
+
+// NewConicGradient returns a ConicGradient with the identity transform.
+func NewConicGradient(cx, cy, angle float64, stops ...rasterx.GradStop) *ConicGradient {
+	return &ConicGradient{Gradient: Gradient{Stops: stops, Matrix: rasterx.Identity},
+		Cx: cx, Cy: cy, Angle: angle}
+}
+
+// prepare builds the color lookup table and inverts the transform.
+func (g *Gradient) prepare() {
+	g.inv = g.Matrix.Invert()
+	stops := make([]rasterx.GradStop, len(g.Stops))
+	copy(stops, g.Stops)
+	sort.SliceStable(stops, func(i, j int) bool { return stops[i].Offset < stops[j].Offset })
+	pre := make([][4]float64, len(stops))
+	for i, s := range stops {
+		r, g, b, a := s.StopColor.RGBA()
+		o := math.Max(0, math.Min(1, s.Opacity))
+		pre[i] = [4]float64{float64(r) * o, float64(g) * o, float64(b) * o, float64(a) * o}
+	}
+	// always a new table, since copies made by prepared share the old one
+	g.lut = make([]color.RGBA64, gradientLUTSize)
+	k := 0
+	for i := range g.lut {
+		t := float64(i) / (gradientLUTSize - 1)
+		for k < len(stops) && stops[k].Offset < t {
+			k++
+		}
+		var c [4]float64
+		switch {
+		case len(stops) == 0:
+		case k == 0:
+			c = pre[0]
+		case k == len(stops):
+			c = pre[k-1]
+		default: // interpolate the premultiplied colors
+			s0, s1 := stops[k-1].Offset, stops[k].Offset
+			f := (t - s0) / (s1 - s0)
+			for j := range c {
+				c[j] = pre[k-1][j] + (pre[k][j]-pre[k-1][j])*f
+			}
+		}
+		g.lut[i] = color.RGBA64{uint16(c[0] + 0.5), uint16(c[1] + 0.5), uint16(c[2] + 0.5), uint16(c[3] + 0.5)}
+	}
+}
+
+// lookup returns the color at the gradient parameter t after applying the spread method.
+func (g *Gradient) lookup(t float64) color.RGBA64 {
+	switch g.Spread {
+	case rasterx.RepeatSpread:
+		t -= math.Floor(t)
+	case rasterx.ReflectSpread:
+		t = math.Abs(t - 2*math.Floor(t/2+0.5))
+	}
+	if !(t > 0) { // also catches NaN
+		return g.lut[0]
+	}
+	if t >= 1 {
+		return g.lut[gradientLUTSize-1]
+	}
+	return g.lut[int(t*(gradientLUTSize-1)+0.5)]
+}
+
+// start returns the gradient space position of the center of pixel (x0, y)
+// and the gradient space step from one pixel to the next along the row.
+func (g *Gradient) start(y, x0 int) (px, py, sx, sy float64) {
+	px, py = g.inv.Transform(float64(x0)+0.5, float64(y)+0.5)
+	sx, sy = g.inv.TransformVector(1, 0)
+	return
+}
+
+// fill sets dst to the last stop color, for degenerate gradient geometry.
+func (g *Gradient) fill(dst []color.RGBA64) {
+	c := g.lut[gradientLUTSize-1]
+	for i := range dst {
+		dst[i] = c
+	}
+}
+
+func (g *LinearGradient) prepared() Paint {
+	c := *g
+	c.prepare()
+	return &c
+}
+
+// FillSpan sets dst[:x1-x0] to the premultiplied colors of the pixels
+// from x0 to x1 of row y.
+func (g *LinearGradient) FillSpan(y, x0, x1 int, dst []color.RGBA64) {
+	if g.lut == nil {
+		g.prepare()
+	}
+	dst = dst[:x1-x0]
+	dx, dy := g.X2-g.X1, g.Y2-g.Y1
+	d := dx*dx + dy*dy
+	if d == 0 {
+		g.fill(dst)
+		return
+	}
+	// t is linear in x, so it is advanced by a constant step
+	px, py, sx, sy := g.start(y, x0)
+	t := ((px-g.X1)*dx + (py-g.Y1)*dy) / d
+	dt := (sx*dx + sy*dy) / d
+	for i := range dst {
+		dst[i] = g.lookup(t)
+		t += dt
+	}
+}
+
+func (g *RadialGradient) prepared() Paint {
+	c := *g
+	c.prepare()
+	return &c
+}
+
+func (g *RadialGradient) prepare() {
+	g.Gradient.prepare()
+	g.fx, g.fy = g.Fx, g.Fy
+	dx, dy := g.Fx-g.Cx, g.Fy-g.Cy
+	if d, lim := math.Hypot(dx, dy), g.R*(1-1e-5); d > lim {
+		g.fx, g.fy = g.Cx+dx*lim/d, g.Cy+dy*lim/d
+	}
+}
+
+// FillSpan sets dst[:x1-x0] to the premultiplied colors of the pixels
+// from x0 to x1 of row y.
+//
+// A point p is colored by the largest t for which it lies on the circle of
+// radius t*R centered at f + t*(c - f). With pd = p - f and cd = c - f this
+// is the root of
+//
+//	(cd·cd - R²)t² - 2(pd·cd)t + pd·pd = 0
+//
+// where pd·cd is linear and pd·pd is quadratic in x, so both are advanced
+// by forward differences and only the square root is taken per pixel.
+func (g *RadialGradient) FillSpan(y, x0, x1 int, dst []color.RGBA64) {
+	if g.lut == nil {
+		g.prepare()
+	}
+	dst = dst[:x1-x0]
+	if g.R <= 0 {
+		g.fill(dst)
+		return
+	}
+	px, py, sx, sy := g.start(y, x0)
+	cdx, cdy := g.Cx-g.fx, g.Cy-g.fy
+	pdx, pdy := px-g.fx, py-g.fy
+	a := cdx*cdx + cdy*cdy - g.R*g.R // negative, since the focus is inside the circle
+	b := pdx*cdx + pdy*cdy
+	db := sx*cdx + sy*cdy
+	c := pdx*pdx + pdy*pdy
+	ss := sx*sx + sy*sy
+	dc := 2*(pdx*sx+pdy*sy) + ss
+	for i := range dst {
+		dst[i] = g.lookup((b - math.Sqrt(math.Max(0, b*b-a*c))) / a)
+		b += db
+		c += dc
+		dc += 2 * ss
+	}
+}
+
+func (g *ConicGradient) prepared() Paint {
+	c := *g
+	c.prepare()
+	return &c
+}
+
+// FillSpan sets dst[:x1-x0] to the premultiplied colors of the pixels
+// from x0 to x1 of row y.
+func (g *ConicGradient) FillSpan(y, x0, x1 int, dst []color.RGBA64) {
+	if g.lut == nil {
+		g.prepare()
+	}
+	dst = dst[:x1-x0]
+	px, py, sx, sy := g.start(y, x0)
+	px, py = px-g.Cx, py-g.Cy
+	for i := range dst {
+		t := (math.Atan2(py, px) - g.Angle) / (2 * math.Pi)
+		dst[i] = g.lookup(t - math.Floor(t))
+		px += sx
+		py += sy
+	}
+}
@@ -0,0 +1,220 @@
+package scanx_test
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/srwiley/rasterx"
+	"github.com/srwiley/scanx"
+)
+
+var gradientStops = []rasterx.GradStop{
+	{StopColor: color.RGBA{0xFF, 0, 0, 0xFF}, Offset: 0, Opacity: 1},
+	{StopColor: color.RGBA{0x20, 0xC0, 0x40, 0xFF}, Offset: 0.4, Opacity: 1},
+	{StopColor: color.RGBA{0, 0, 0xFF, 0xFF}, Offset: 1, Opacity: 1},
+}
+
+// paintDiff returns the largest channel difference between the paint and
+// the color function over a w by h area.
+func paintDiff(p interface {
+	FillSpan(y, x0, x1 int, dst []color.RGBA64)
+}, f rasterx.ColorFunc, w, h int) (worst int) {
+	row := make([]color.RGBA64, w)
+	for y := 0; y < h; y++ {
+		p.FillSpan(y, 0, w, row)
+		for x, c := range row {
+			r, g, b, a := f(x, y).RGBA()
+			for k, v := range [4]uint32{r, g, b, a} {
+				d := int([4]uint16{c.R, c.G, c.B, c.A}[k]>>8) - int(v>>8)
+				if d < 0 {
+					d = -d
+				}
+				if d > worst {
+					worst = d
+				}
+			}
+		}
+	}
+	return
+}
+
+func TestGradientVsColorFunc(t *testing.T) {
+	for _, spread := range []rasterx.SpreadMethod{rasterx.PadSpread, rasterx.ReflectSpread} {
+		rg := rasterx.Gradient{Points: [5]float64{20, 10, 70, 50}, Stops: gradientStops,
+			Matrix: rasterx.Identity, Spread: spread, Units: rasterx.UserSpaceOnUse}
+		rg.Bounds.W, rg.Bounds.H = 1, 1
+		lg := scanx.NewLinearGradient(20, 10, 70, 50, gradientStops...)
+		lg.Spread = spread
+		if d := paintDiff(lg, rg.GetColorFunction(1).(rasterx.ColorFunc), 100, 80); d > 2 {
+			t.Errorf("linear spread %d differs by %d", spread, d)
+		}
+
+		rg.IsRadial = true
+		rg.Points = [5]float64{50, 40, 35, 30, 30}
+		radial := scanx.NewRadialGradient(50, 40, 30, 35, 30, gradientStops...)
+		radial.Spread = spread
+		if d := paintDiff(radial, rg.GetColorFunction(1).(rasterx.ColorFunc), 100, 80); d > 2 {
+			t.Errorf("radial spread %d differs by %d", spread, d)
+		}
+	}
+}
+
+func TestGradientSpread(t *testing.T) {
+	red, blue := color.RGBA64{0xFFFF, 0, 0, 0xFFFF}, color.RGBA64{0, 0, 0xFFFF, 0xFFFF}
+	stops := []rasterx.GradStop{
+		{StopColor: color.RGBA{0xFF, 0, 0, 0xFF}, Offset: 0, Opacity: 1},
+		{StopColor: color.RGBA{0, 0, 0xFF, 0xFF}, Offset: 1, Opacity: 1}}
+	// the gradient runs over pixel centers 0.5 to 10.5
+	for _, tc := range []struct {
+		spread rasterx.SpreadMethod
+		x      int
+		want   color.RGBA64
+	}{
+		{rasterx.PadSpread, 0, red},
+		{rasterx.PadSpread, 15, blue},
+		{rasterx.RepeatSpread, 20, red},
+		{rasterx.RepeatSpread, 12, color.RGBA64{0xCCCC, 0, 0x3333, 0xFFFF}},
+		{rasterx.ReflectSpread, 20, red},
+		{rasterx.ReflectSpread, 12, color.RGBA64{0x3333, 0, 0xCCCC, 0xFFFF}},
+	} {
+		g := scanx.NewLinearGradient(0.5, 0, 10.5, 0, stops...)
+		g.Spread = tc.spread
+		dst := make([]color.RGBA64, 1)
+		g.FillSpan(0, tc.x, tc.x+1, dst)
+		for k, v := range [4]uint16{dst[0].R, dst[0].G, dst[0].B, dst[0].A} {
+			w := [4]uint16{tc.want.R, tc.want.G, tc.want.B, tc.want.A}[k]
+			if d := int(v) - int(w); d < -0x80 || d > 0x80 {
+				t.Errorf("spread %d at %d gave %v, want %v", tc.spread, tc.x, dst[0], tc.want)
+				break
+			}
+		}
+	}
+}
+
+func TestConicGradient(t *testing.T) {
+	g := scanx.NewConicGradient(50, 50, 0, gradientStops[0], gradientStops[2])
+	dst := make([]color.RGBA64, 1)
+	for _, tc := range []struct {
+		x, y int
+		t    float64
+	}{{80, 50, 0}, {50, 80, 0.25}, {20, 50, 0.5}, {50, 20, 0.75}} {
+		g.FillSpan(tc.y, tc.x, tc.x+1, dst)
+		if want := tc.t * 0xFFFF; math.Abs(float64(dst[0].B)-want) > 0x200 {
+			t.Errorf("(%d, %d) gave %v, want blue %.0f", tc.x, tc.y, dst[0], want)
+		}
+	}
+	// rotating the transform rotates the gradient
+	g = scanx.NewConicGradient(50, 50, 0, gradientStops[0], gradientStops[2])
+	g.Matrix = rasterx.Identity.Translate(50, 50).Rotate(math.Pi/2).Translate(-50, -50)
+	g.FillSpan(80, 49, 50, dst)
+	if dst[0].B > 0x200 {
+		t.Errorf("rotated gradient gave %v, want red", dst[0])
+	}
+}
+
+func TestGradientSpanners(t *testing.T) {
+	w, h := 120, 90
+	rg := rasterx.Gradient{Points: [5]float64{60, 45, 40, 30, 50}, Stops: gradientStops,
+		Matrix: rasterx.Identity, Units: rasterx.UserSpaceOnUse, IsRadial: true}
+	rg.Bounds.W, rg.Bounds.H = 1, 1
+	colorFunc := rg.GetColorFunction(1).(rasterx.ColorFunc)
+	paint := scanx.NewRadialGradient(60, 45, 50, 40, 30, gradientStops...)
+	img1 := image.NewRGBA(image.Rect(0, 0, w, h))
+	img2 := image.NewRGBA(image.Rect(0, 0, w, h))
+	img3 := image.NewRGBA(image.Rect(0, 0, w, h))
+	background := color.RGBA{0x40, 0x40, 0x40, 0xFF}
+
+	spanner1 := scanx.NewImgSpanner(img1)
+	spanner2 := scanx.NewImgSpanner(img2)
+	lspanner := &scanx.LinkListSpanner{}
+	lspanner.SetBounds(img3.Bounds())
+	draw := func(s scanx.Spanner, c interface{}) {
+		s.SetColor(background)
+		f := s.GetSpanFunc()
+		for y := 0; y < h; y++ {
+			f(y, 0, w, 0xFFFF)
+		}
+		s.SetColor(c)
+		f = s.GetSpanFunc()
+		for y := 0; y < h; y++ {
+			f(y, 10, 100, uint32(y*0xFFFF/h))
+		}
+	}
+	draw(spanner1, colorFunc)
+	draw(spanner2, paint)
+	draw(lspanner, paint)
+	lspanner.DrawToImage(img3)
+	if d := MaxPixDiff(img1, img2); d > 6 {
+		t.Errorf("ImgSpanner gradient paint differs from color function by %d", d)
+	}
+	if d := MaxPixDiff(img2, img3); d > 3 {
+		t.Errorf("LinkListSpanner gradient paint differs from ImgSpanner by %d", d)
+	}
+}
+
+func benchmarkGradient(b *testing.B, c interface{}) {
+	img := image.NewRGBA(image.Rect(0, 0, 512, 512))
+	spanner := scanx.NewImgSpanner(img)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		spanner.SetColor(c)
+		f := spanner.GetSpanFunc()
+		for y := 0; y < 512; y++ {
+			f(y, 0, 512, 0xFFFF)
+		}
+	}
+}
+
+func BenchmarkGradientColorFunc(b *testing.B) {
+	rg := rasterx.Gradient{Points: [5]float64{256, 256, 200, 200, 256}, Stops: gradientStops,
+		Matrix: rasterx.Identity, Units: rasterx.UserSpaceOnUse, IsRadial: true}
+	rg.Bounds.W, rg.Bounds.H = 1, 1
+	benchmarkGradient(b, rg.GetColorFunction(1))
+}
+
+func BenchmarkGradientPaint(b *testing.B) {
+	benchmarkGradient(b, scanx.NewRadialGradient(256, 256, 256, 200, 200, gradientStops...))
+}
+
+func TestSharedGradient(t *testing.T) {
+	// SetColor prepares a private copy, so one gradient may be set on
+	// spanners in several goroutines
+	lg := scanx.NewLinearGradient(0, 0, 64, 48, gradientStops...)
+	before := *lg
+	bounds := image.Rect(0, 0, 64, 48)
+	draw := func() *image.RGBA {
+		img := image.NewRGBA(bounds)
+		spanner := scanx.NewImgSpanner(img)
+		for i := 0; i < 20; i++ {
+			spanner.SetColor(lg)
+			f := spanner.GetSpanFunc()
+			for y := i; y < 48; y += 20 {
+				f(y, 0, 64, 0xFFFF)
+			}
+		}
+		return img
+	}
+	want := draw()
+	var wg sync.WaitGroup
+	imgs := make([]*image.RGBA, 4)
+	for i := range imgs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			imgs[i] = draw()
+		}()
+	}
+	wg.Wait()
+	for i, img := range imgs {
+		if d := MaxPixDiff(img, want); d != 0 {
+			t.Errorf("goroutine %d drew the shared gradient differently by %d", i, d)
+		}
+	}
+	if !reflect.DeepEqual(before, *lg) {
+		t.Error("SetColor changed the gradient")
+	}
+}
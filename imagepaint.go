@@ -0,0 +1,201 @@
+package scanx
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/srwiley/rasterx"
+)
+
+// ImageFilter selects how an ImagePaint samples its image between pixel centers.
+type ImageFilter int
+
+const (
+	// NearestFilter uses the image pixel containing the sample point.
+	NearestFilter ImageFilter = iota
+	// BilinearFilter interpolates the four nearest image pixels.
+	BilinearFilter
+	// BicubicFilter applies a Catmull-Rom spline to the sixteen nearest
+	// image pixels, which is sharper than BilinearFilter when enlarging.
+	BicubicFilter
+)
+
+// ImagePaint is a Paint that fills spans with an image, such as an SVG
+// pattern or a photo clipped to a path. Matrix maps image coordinates to
+// the pixel coordinates of the spanner, and Spread selects how the image
+// is tiled outside of its bounds: PadSpread extends the edge pixels,
+// RepeatSpread repeats the image and ReflectSpread mirrors it.
+//
+// Like the gradients, the inverse transform is computed for a private copy
+// of the paint when it is passed to SetColor. Images are sampled directly if
+// they are *image.RGBA or *image.RGBA64, and other images are converted to
+// *image.RGBA64 at that time. NewImagePaint does that conversion once
+// instead, so a paint that is set often, such as an SVG pattern that fills
+// many paths, should be made with it.
+type ImagePaint struct {
+	Image  image.Image
+	Matrix rasterx.Matrix2D
+	Filter ImageFilter
+	Spread rasterx.SpreadMethod
+	inv    rasterx.Matrix2D
+	rect   image.Rectangle
+	rgba   *image.RGBA
+	rgba64 *image.RGBA64
+}
+
+// NewImagePaint returns an ImagePaint of img with the identity transform,
+// nearest filtering and pad spread. If img is not an *image.RGBA or an
+// *image.RGBA64, the Image of the paint is a conversion of img to
+// *image.RGBA64, so later changes to img are not seen.
+func NewImagePaint(img image.Image) *ImagePaint {
+	switch img.(type) {
+	case *image.RGBA, *image.RGBA64:
+	default:
+		img = toRGBA64(img)
+	}
+	return &ImagePaint{Image: img, Matrix: rasterx.Identity}
+}
+
+// toRGBA64 returns a copy of img as an *image.RGBA64.
+func toRGBA64(img image.Image) *image.RGBA64 {
+	r := img.Bounds()
+	c := image.NewRGBA64(r)
+	draw.Draw(c, r, img, r.Min, draw.Src)
+	return c
+}
+
+func (p *ImagePaint) prepared() Paint {
+	c := *p
+	c.prepare()
+	return &c
+}
+
+func (p *ImagePaint) prepare() {
+	p.inv = p.Matrix.Invert()
+	p.rect = p.Image.Bounds()
+	p.rgba, p.rgba64 = nil, nil
+	switch img := p.Image.(type) {
+	case *image.RGBA:
+		p.rgba = img
+	case *image.RGBA64:
+		p.rgba64 = img
+	default:
+		p.rgba64 = toRGBA64(img)
+	}
+}
+
+// tile maps the coordinate i onto the range [lo, hi) according to the spread method.
+func tile(i, lo, hi int, spread rasterx.SpreadMethod) int {
+	n := hi - lo
+	switch spread {
+	case rasterx.RepeatSpread:
+		i = (i - lo) % n
+		if i < 0 {
+			i += n
+		}
+		return lo + i
+	case rasterx.ReflectSpread:
+		i = (i - lo) % (2 * n)
+		if i < 0 {
+			i += 2 * n
+		}
+		if i >= n {
+			i = 2*n - 1 - i
+		}
+		return lo + i
+	}
+	if i < lo {
+		return lo
+	}
+	if i >= hi {
+		return hi - 1
+	}
+	return i
+}
+
+// texel returns the premultiplied color of the image pixel at (ix, iy) after tiling.
+func (p *ImagePaint) texel(ix, iy int) [4]float64 {
+	ix = tile(ix, p.rect.Min.X, p.rect.Max.X, p.Spread)
+	iy = tile(iy, p.rect.Min.Y, p.rect.Max.Y, p.Spread)
+	if p.rgba != nil {
+		i := p.rgba.PixOffset(ix, iy)
+		s := p.rgba.Pix[i : i+4 : i+4]
+		return [4]float64{float64(s[0]) * 0x101, float64(s[1]) * 0x101, float64(s[2]) * 0x101, float64(s[3]) * 0x101}
+	}
+	c := p.rgba64.RGBA64At(ix, iy)
+	return [4]float64{float64(c.R), float64(c.G), float64(c.B), float64(c.A)}
+}
+
+// catmullRom returns the weights of the four pixels around a sample at
+// fraction t between the middle two.
+func catmullRom(t float64) [4]float64 {
+	return [4]float64{
+		((-0.5*t+1)*t - 0.5) * t,
+		(1.5*t-2.5)*t*t + 1,
+		((-1.5*t+2)*t + 0.5) * t,
+		(0.5*t - 0.5) * t * t}
+}
+
+// sample returns the filtered color at (u, v) in image coordinates.
+func (p *ImagePaint) sample(u, v float64) color.RGBA64 {
+	var c [4]float64
+	switch p.Filter {
+	case BilinearFilter, BicubicFilter:
+		u, v = u-0.5, v-0.5 // relative to pixel centers
+		fu, fv := math.Floor(u), math.Floor(v)
+		ix, iy := int(fu), int(fv)
+		tu, tv := u-fu, v-fv
+		if p.Filter == BilinearFilter {
+			for j, wv := range [2]float64{1 - tv, tv} {
+				for i, wu := range [2]float64{1 - tu, tu} {
+					t := p.texel(ix+i, iy+j)
+					for k := range c {
+						c[k] += t[k] * wu * wv
+					}
+				}
+			}
+			break
+		}
+		wus, wvs := catmullRom(tu), catmullRom(tv)
+		for j, wv := range wvs {
+			for i, wu := range wus {
+				t := p.texel(ix+i-1, iy+j-1)
+				for k := range c {
+					c[k] += t[k] * wu * wv
+				}
+			}
+		}
+		// the spline overshoots, so keep the color valid and premultiplied
+		c[3] = math.Max(0, math.Min(m, c[3]))
+		for k := 0; k < 3; k++ {
+			c[k] = math.Max(0, math.Min(c[3], c[k]))
+		}
+	default:
+		c = p.texel(int(math.Floor(u)), int(math.Floor(v)))
+	}
+	return color.RGBA64{uint16(c[0] + 0.5), uint16(c[1] + 0.5), uint16(c[2] + 0.5), uint16(c[3] + 0.5)}
+}
+
+// FillSpan sets dst[:x1-x0] to the premultiplied colors of the pixels
+// from x0 to x1 of row y.
+func (p *ImagePaint) FillSpan(y, x0, x1 int, dst []color.RGBA64) {
+	if p.rgba == nil && p.rgba64 == nil {
+		p.prepare()
+	}
+	dst = dst[:x1-x0]
+	if p.rect.Empty() {
+		for i := range dst {
+			dst[i] = color.RGBA64{}
+		}
+		return
+	}
+	u, v := p.inv.Transform(float64(x0)+0.5, float64(y)+0.5)
+	su, sv := p.inv.TransformVector(1, 0)
+	for i := range dst {
+		dst[i] = p.sample(u, v)
+		u += su
+		v += sv
+	}
+}
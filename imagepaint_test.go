@@ -0,0 +1,166 @@
+package scanx_test
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/srwiley/rasterx"
+	"github.com/srwiley/scanx"
+)
+
+func texture() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	for i, c := range []color.NRGBA{
+		{0xFF, 0, 0, 0xFF}, {0, 0xFF, 0, 0xFF}, {0, 0, 0xFF, 0xFF},
+		{0xFF, 0xFF, 0, 0x80}, {0, 0, 0, 0xFF}, {0xFF, 0xFF, 0xFF, 0xFF}} {
+		img.SetNRGBA(i%3, i/3, c)
+	}
+	return img
+}
+
+func TestImagePaintTiling(t *testing.T) {
+	tex := texture()
+	for _, tc := range []struct {
+		spread rasterx.SpreadMethod
+		xs, ys []int // the texture pixels expected for x = 0 to 6 and y = 0 to 3
+	}{
+		{rasterx.PadSpread, []int{0, 0, 0, 0, 1, 2, 2}, []int{0, 0, 1, 1}},
+		{rasterx.RepeatSpread, []int{0, 1, 2, 0, 1, 2, 0}, []int{1, 0, 1, 0}},
+		{rasterx.ReflectSpread, []int{2, 1, 0, 0, 1, 2, 2}, []int{0, 0, 1, 1}},
+	} {
+		p := scanx.NewImagePaint(tex)
+		p.Spread = tc.spread
+		// the texture is placed at (3, 1)
+		p.Matrix = rasterx.Identity.Translate(3, 1)
+		row := make([]color.RGBA64, 7)
+		for y, ty := range tc.ys {
+			p.FillSpan(y, 0, 7, row)
+			for x, tx := range tc.xs {
+				r, g, b, a := tex.At(tx, ty).RGBA()
+				if want := (color.RGBA64{uint16(r), uint16(g), uint16(b), uint16(a)}); row[x] != want {
+					t.Errorf("spread %d at (%d, %d) gave %v, want %v", tc.spread, x, y, row[x], want)
+				}
+			}
+		}
+	}
+}
+
+func TestImagePaintFilters(t *testing.T) {
+	tex := texture()
+	for _, filter := range []scanx.ImageFilter{scanx.NearestFilter, scanx.BilinearFilter, scanx.BicubicFilter} {
+		// scaled up by 4, the centers of texture pixels fall between spanner pixels
+		// so shift by half a pixel to sample the texture pixel centers exactly
+		p := scanx.NewImagePaint(tex)
+		p.Filter = filter
+		p.Matrix = rasterx.Identity.Translate(-1.5, -1.5).Scale(4, 4)
+		row := make([]color.RGBA64, 1)
+		for ty := 0; ty < 2; ty++ {
+			for tx := 0; tx < 3; tx++ {
+				p.FillSpan(4*ty, 4*tx, 4*tx+1, row)
+				r, g, b, a := tex.At(tx, ty).RGBA()
+				if want := (color.RGBA64{uint16(r), uint16(g), uint16(b), uint16(a)}); row[0] != want {
+					t.Errorf("filter %d at texture pixel (%d, %d) gave %v, want %v", filter, tx, ty, row[0], want)
+				}
+			}
+		}
+	}
+
+	// a constant image stays constant under every filter and transform
+	gray := image.NewUniform(color.RGBA{0x40, 0x50, 0x60, 0x80})
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := 0; i < 16; i++ {
+		img.Set(i%4, i/4, gray)
+	}
+	for _, filter := range []scanx.ImageFilter{scanx.BilinearFilter, scanx.BicubicFilter} {
+		p := scanx.NewImagePaint(img)
+		p.Filter, p.Spread = filter, rasterx.RepeatSpread
+		p.Matrix = rasterx.Identity.Rotate(0.3).Scale(2.7, 1.3)
+		row := make([]color.RGBA64, 20)
+		p.FillSpan(7, 0, 20, row)
+		for x, c := range row {
+			if c != (color.RGBA64{0x4040, 0x5050, 0x6060, 0x8080}) {
+				t.Fatalf("filter %d at %d gave %v", filter, x, c)
+			}
+		}
+	}
+
+	// bilinear filtering blends neighboring pixels
+	p := scanx.NewImagePaint(tex)
+	p.Filter = scanx.BilinearFilter
+	p.Matrix = rasterx.Identity.Scale(2, 1)
+	row := make([]color.RGBA64, 1)
+	p.FillSpan(0, 2, 3, row) // three quarters of the way from red to green
+	if want := (color.RGBA64{0x4000, 0xBFFF, 0, 0xFFFF}); row[0] != want {
+		t.Errorf("bilinear gave %v, want %v", row[0], want)
+	}
+}
+
+func TestImagePaintSpanners(t *testing.T) {
+	tex := image.NewRGBA(image.Rect(0, 0, 5, 7))
+	for i := range tex.Pix {
+		tex.Pix[i] = uint8(i * 37)
+		if i%4 == 3 {
+			tex.Pix[i] = 0xFF
+		}
+	}
+	bounds := image.Rect(0, 0, 20, 14)
+	img1 := image.NewRGBA(bounds)
+	spanner := scanx.NewImgSpanner(img1)
+	p := scanx.NewImagePaint(tex)
+	p.Spread = rasterx.RepeatSpread
+	spanner.SetColor(p)
+	lspanner := &scanx.LinkListSpanner{}
+	lspanner.SetBounds(bounds)
+	lspanner.SetColor(p)
+	for _, s := range []scanx.Spanner{spanner, lspanner} {
+		f := s.GetSpanFunc()
+		for y := 0; y < 14; y++ {
+			f(y, 0, 20, 0xFFFF)
+		}
+	}
+	img2 := image.NewRGBA(bounds)
+	lspanner.DrawToImage(img2)
+	for y := 0; y < 14; y++ {
+		for x := 0; x < 20; x++ {
+			want := tex.RGBAAt(x%5, y%7)
+			if got := img1.RGBAAt(x, y); got != want {
+				t.Fatalf("ImgSpanner at (%d, %d) gave %v, want %v", x, y, got, want)
+			}
+			if got := img2.RGBAAt(x, y); got != want {
+				t.Fatalf("LinkListSpanner at (%d, %d) gave %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestImagePaintConvertOnce(t *testing.T) {
+	// NewImagePaint converts other image types once, and paints the same
+	// as a paint that converts its image at every SetColor
+	tex := texture()
+	p := scanx.NewImagePaint(tex)
+	if _, ok := p.Image.(*image.RGBA64); !ok {
+		t.Fatalf("NewImagePaint kept a %T", p.Image)
+	}
+	literal := &scanx.ImagePaint{Image: tex, Matrix: rasterx.Identity}
+	for _, paint := range []*scanx.ImagePaint{p, literal} {
+		paint.Spread = rasterx.RepeatSpread
+		paint.Matrix = rasterx.Identity.Scale(1.5, 2)
+	}
+	bounds := image.Rect(0, 0, 12, 8)
+	img1, img2 := image.NewRGBA(bounds), image.NewRGBA(bounds)
+	fillRect(scanx.NewImgSpanner(img1), p, bounds)
+	fillRect(scanx.NewImgSpanner(img2), literal, bounds)
+	if d := MaxPixDiff(img1, img2); d != 0 {
+		t.Errorf("converted paint differs by %d", d)
+	}
+}
+
+func BenchmarkImagePaintSetColor(b *testing.B) {
+	tex := image.NewNRGBA(image.Rect(0, 0, 256, 256))
+	p := scanx.NewImagePaint(tex)
+	spanner := scanx.NewImgSpanner(image.NewRGBA(image.Rect(0, 0, 16, 16)))
+	for i := 0; i < b.N; i++ {
+		spanner.SetColor(p)
+	}
+}
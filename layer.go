@@ -0,0 +1,159 @@
+package scanx
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+type (
+	// layerState is the part of a layer common to the spanners: the area of
+	// the layer, how it is composited, and the clip to restore on pop.
+	layerState struct {
+		rect    image.Rectangle
+		opacity uint32
+		blend   BlendMode
+		clip    image.Rectangle
+	}
+
+	// imgLayer is a layer of an ImgSpanner and the image state below it.
+	imgLayer struct {
+		layerState
+		pix            []uint8
+		stride, offset int
+	}
+
+	// linkLayer is a layer of a LinkListSpanner and the span lists below it.
+	linkLayer struct {
+		layerState
+		spans   spanList
+		bgColor color.RGBA
+	}
+)
+
+// beginLayer clips spans to bounds, limited to the spanner and any enclosing
+// layer, and returns the state to restore with endLayer.
+func (x *baseSpanner) beginLayer(bounds image.Rectangle, opacity float64, blend BlendMode) layerState {
+	l := layerState{opacity: opacity16(opacity), blend: blend, clip: x.clip}
+	l.rect = bounds.Intersect(x.clip)
+	x.clip = l.rect
+	return l
+}
+
+func (x *baseSpanner) endLayer(l layerState) {
+	x.clip = l.clip
+}
+
+// PushLayer starts drawing into a transparent offscreen layer covering
+// bounds, in image coordinates. Spans outside of bounds are discarded. The
+// layer is composited once onto the image below by PopLayer, with the
+// opacity and blend mode, as for an SVG group with opacity or a
+// mix-blend-mode. Layers may be nested. Since the span function depends on
+// the layer, GetSpanFunc must be called again after PushLayer and PopLayer.
+func (x *ImgSpanner) PushLayer(bounds image.Rectangle, opacity float64, blend BlendMode) {
+	l := imgLayer{layerState: x.beginLayer(bounds, opacity, blend),
+		pix: x.pix, stride: x.stride, offset: x.offset}
+	r := l.rect
+	n := r.Dx() * r.Dy() * 4
+	var buf []uint8
+	if k := len(x.layerPool); k > 0 {
+		buf = x.layerPool[k-1]
+		x.layerPool = x.layerPool[:k-1]
+	}
+	if cap(buf) < n {
+		buf = make([]uint8, n)
+	}
+	buf = buf[:n]
+	for i := range buf {
+		buf[i] = 0
+	}
+	x.pix, x.stride = buf, r.Dx()*4
+	x.offset = pixOrigin(x.stride, 4, r, image.Point{})
+	x.layers = append(x.layers, l)
+}
+
+// PopLayer composites the last pushed layer onto the image below it.
+// It does nothing if no layer is pushed.
+func (x *ImgSpanner) PopLayer() {
+	k := len(x.layers)
+	if k == 0 {
+		return
+	}
+	l := x.layers[k-1]
+	x.layers = x.layers[:k-1]
+	src, srcStride, srcOffset := x.pix, x.stride, x.offset
+	x.pix, x.stride, x.offset = l.pix, l.stride, l.offset
+	x.endLayer(l.layerState)
+	x.layerPool = append(x.layerPool, src)
+	if l.opacity == 0 {
+		return
+	}
+	comp := baseSpanner{Op: draw.Over, Blend: l.blend, LinearLight: x.LinearLight}
+	fast := comp.fastOp()
+	r := l.rect
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		si := y*srcStride + r.Min.X*4 + srcOffset
+		di := y*x.stride + r.Min.X*4 + x.offset
+		for i := r.Min.X; i < r.Max.X; i++ {
+			if src[si+3] != 0 {
+				if fast {
+					c := overRGBA(color.RGBA{src[si], src[si+1], src[si+2], src[si+3]},
+						color.RGBA{x.pix[di], x.pix[di+1], x.pix[di+2], x.pix[di+3]}, l.opacity)
+					x.pix[di], x.pix[di+1], x.pix[di+2], x.pix[di+3] = c.R, c.G, c.B, c.A
+				} else {
+					comp.compositePix(x.pix, di, uint32(src[si])*pa, uint32(src[si+1])*pa,
+						uint32(src[si+2])*pa, uint32(src[si+3])*pa, l.opacity, x.xpixel)
+				}
+			}
+			si += 4
+			di += 4
+		}
+	}
+}
+
+// PushLayer starts accumulating spans into a transparent layer covering
+// bounds, in span coordinates. Spans outside of bounds are discarded. The
+// spans of the layer are composited once onto the spans below by PopLayer,
+// with the opacity and blend mode, as for an SVG group with opacity or a
+// mix-blend-mode. Layers may be nested, and must all be popped before
+// DrawToImage. GetSpanFunc must be called again after PushLayer and PopLayer.
+func (x *LinkListSpanner) PushLayer(bounds image.Rectangle, opacity float64, blend BlendMode) {
+	x.layers = append(x.layers, linkLayer{layerState: x.beginLayer(bounds, opacity, blend),
+		spans: x.spans, bgColor: x.bgColor})
+	x.spans = spanList{}
+	if k := len(x.spanPool); k > 0 {
+		x.spans = x.spanPool[k-1]
+		x.spanPool = x.spanPool[:k-1]
+	}
+	x.bgColor = color.RGBA{}
+	x.Clear()
+}
+
+// PopLayer composites the spans of the last pushed layer onto the spans
+// below it. It does nothing if no layer is pushed.
+func (x *LinkListSpanner) PopLayer() {
+	k := len(x.layers)
+	if k == 0 {
+		return
+	}
+	l := x.layers[k-1]
+	x.layers = x.layers[:k-1]
+	spans := x.spans
+	x.spans, x.bgColor = l.spans, l.bgColor
+	x.endLayer(l.layerState)
+	x.spanPool = append(x.spanPool, spans)
+	if l.opacity == 0 {
+		return
+	}
+	fgColor, op, composite, blend := x.fgColor, x.Op, x.Composite, x.Blend
+	x.Op, x.Composite, x.Blend = draw.Over, DrawOp, l.blend
+	for y := l.rect.Min.Y; y < l.rect.Max.Y; y++ {
+		for c := range spans.row(y - x.bounds.Min.Y) {
+			if c.clr.A != 0 {
+				x.fgColor = c.clr
+				x.SpanOver(y, c.x0, c.x1, l.opacity)
+			}
+		}
+	}
+	x.fgColor, x.Op, x.Composite, x.Blend = fgColor, op, composite, blend
+}
@@ -0,0 +1,105 @@
+package scanx_test
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/srwiley/rasterx"
+	"github.com/srwiley/scanx"
+)
+
+// layered is implemented by the spanners that support layers.
+type layered interface {
+	scanx.Spanner
+	PushLayer(bounds image.Rectangle, opacity float64, blend scanx.BlendMode)
+	PopLayer()
+}
+
+// fillRect fills r with the color or paint c using the span function of s.
+func fillRect(s scanx.Spanner, c interface{}, r image.Rectangle) {
+	s.SetColor(c)
+	f := s.GetSpanFunc()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		f(y, r.Min.X, r.Max.X, 0xFFFF)
+	}
+}
+
+func TestLayers(t *testing.T) {
+	bounds := image.Rect(0, 0, 16, 8)
+	red := color.RGBA{0xFF, 0, 0, 0xFF}
+	blue := color.RGBA{0, 0, 0xFF, 0xFF}
+	green := color.RGBA{0, 0xFF, 0, 0xFF}
+	gray := color.RGBA{0x80, 0x80, 0x80, 0xFF}
+
+	draw := func(s layered) {
+		fillRect(s, red, bounds)
+		// overlapping opaque squares in a half opaque group show only
+		// the top square where they overlap
+		s.PushLayer(image.Rect(0, 0, 8, 8), 0.5, scanx.BlendNormal)
+		fillRect(s, blue, image.Rect(0, 0, 6, 8))
+		fillRect(s, green, image.Rect(4, 0, 12, 8)) // clipped at 8
+		s.PopLayer()
+		// a multiply group over the right half, with a nested group
+		s.PushLayer(image.Rect(8, 0, 16, 8), 1, scanx.BlendMultiply)
+		fillRect(s, gray, image.Rect(8, 0, 16, 4))
+		s.PushLayer(image.Rect(8, 4, 16, 8), 1, scanx.BlendNormal)
+		fillRect(s, green, image.Rect(8, 4, 16, 8))
+		s.PopLayer()
+		s.PopLayer()
+	}
+
+	img1 := image.NewRGBA(bounds)
+	draw(scanx.NewImgSpanner(img1))
+	lspanner := &scanx.LinkListSpanner{}
+	lspanner.SetBounds(bounds)
+	draw(lspanner)
+	img2 := image.NewRGBA(bounds)
+	lspanner.DrawToImage(img2)
+
+	for _, tc := range []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{1, 1, color.RGBA{0x7F, 0, 0x80, 0xFF}},
+		{5, 1, color.RGBA{0x7F, 0x80, 0, 0xFF}},
+		{9, 1, color.RGBA{0x80, 0, 0, 0xFF}},
+		{9, 6, color.RGBA{0, 0, 0, 0xFF}},
+	} {
+		for k, img := range []*image.RGBA{img1, img2} {
+			if got := img.RGBAAt(tc.x, tc.y); got != tc.want {
+				t.Errorf("spanner %d at (%d, %d) gave %v, want %v", k, tc.x, tc.y, got, tc.want)
+			}
+		}
+	}
+	if d := MaxPixDiff(img1, img2); d != 0 {
+		t.Errorf("spanners differ by %d", d)
+	}
+}
+
+func TestLayerSpanners(t *testing.T) {
+	width, height := 200, 175
+	file := "testdata/svg/landscapeIcons/mountains.svg"
+	background := color.RGBA{0x20, 0x60, 0xA0, 0xFF}
+	for _, blend := range []scanx.BlendMode{scanx.BlendNormal, scanx.BlendScreen} {
+		img1 := image.NewRGBA(image.Rect(0, 0, width, height))
+		spanner := scanx.NewImgSpanner(img1)
+		lspanner := &scanx.LinkListSpanner{}
+		lspanner.SetBounds(img1.Bounds())
+		for _, s := range []layered{spanner, lspanner} {
+			fillRect(s, background, img1.Bounds())
+			s.PushLayer(image.Rect(20, 10, 180, 150), 0.7, blend)
+			scanner := scanx.NewScanner(s, width, height)
+			ReadTestIcon(t, file, width, height).Draw(rasterx.NewDasher(width, height, scanner), 1.0)
+			s.PopLayer()
+		}
+		img2 := image.NewRGBA(img1.Bounds())
+		lspanner.DrawToImage(img2)
+		if d := MaxPixDiff(img1, img2); d != 0 {
+			t.Errorf("blend %d: spanners differ by %d", blend, d)
+		}
+		if got := img1.RGBAAt(10, 160); got != background {
+			t.Errorf("blend %d: outside of the layer is %v, want %v", blend, got, background)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package scanx
+
+import (
+	"math"
+	"sync"
+)
+
+var (
+	linearOnce sync.Once
+	// srgbToLinear maps 8 bit sRGB values to 16 bit linear light.
+	srgbToLinear [256]uint16
+	// linearToSrgb maps 16 bit linear light to 8 bit sRGB values.
+	linearToSrgb []uint8
+)
+
+// initLinear builds the lookup tables on first use of linear light compositing.
+func initLinear() {
+	for i := range srgbToLinear {
+		v := float64(i) / 0xFF
+		if v <= 0.04045 {
+			v /= 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		srgbToLinear[i] = uint16(math.Round(v * m))
+	}
+	linearToSrgb = make([]uint8, m+1)
+	for i := range linearToSrgb {
+		v := float64(i) / m
+		if v <= 0.0031308 {
+			v *= 12.92
+		} else {
+			v = 1.055*math.Pow(v, 1/2.4) - 0.055
+		}
+		linearToSrgb[i] = uint8(math.Round(v * 0xFF))
+	}
+}
+
+// toLinear16 converts the premultiplied 16 bit sRGB channel c with alpha a
+// to premultiplied 16 bit linear light.
+func toLinear16(c, a uint32) uint32 {
+	if a == 0 {
+		return 0
+	}
+	if c > a { // not a valid premultiplied color
+		c = a
+	}
+	linearOnce.Do(initLinear)
+	return (uint32(srgbToLinear[(c*0xFF+a/2)/a])*a + m/2) / m
+}
+
+// fromLinear16 converts the premultiplied 16 bit linear light channel c with
+// alpha a to premultiplied 16 bit sRGB.
+func fromLinear16(c, a uint32) uint32 {
+	if a == 0 {
+		return 0
+	}
+	linearOnce.Do(initLinear)
+	l := (c*m + a/2) / a
+	if l > m {
+		l = m
+	}
+	return (uint32(linearToSrgb[l])*pa*a + m/2) / m
+}
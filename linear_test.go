@@ -0,0 +1,109 @@
+package scanx_test
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/srwiley/rasterx"
+	"github.com/srwiley/scanx"
+)
+
+func decodeSRGB(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func encodeSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// TestLinearLightEdges draws opaque colors over contrasting opaque
+// backgrounds at partial coverage, as at the antialiased edge of a shape,
+// and checks that the mix is done in linear light rather than sRGB.
+func TestLinearLightEdges(t *testing.T) {
+	pairs := [][2]color.RGBA{
+		{{0xFF, 0, 0, 0xFF}, {0, 0xFF, 0, 0xFF}},
+		{{0, 0, 0xFF, 0xFF}, {0xFF, 0xFF, 0, 0xFF}},
+		{{0xFF, 0xFF, 0xFF, 0xFF}, {0, 0, 0, 0xFF}},
+		{{0x20, 0x80, 0xD0, 0xFF}, {0xF0, 0x40, 0x10, 0xFF}},
+	}
+	bounds := image.Rect(0, 0, 1, 1)
+	for _, pair := range pairs {
+		src, dst := pair[0], pair[1]
+		for _, cov := range []uint32{0x4000, 0x8000, 0xC000} {
+			fc := float64(cov) / 0xFFFF
+			mix := func(s, d uint8) float64 {
+				l := decodeSRGB(float64(s)/255)*fc + decodeSRGB(float64(d)/255)*(1-fc)
+				return encodeSRGB(l) * 255
+			}
+			want := [3]float64{mix(src.R, dst.R), mix(src.G, dst.G), mix(src.B, dst.B)}
+
+			img := image.NewRGBA(bounds)
+			img.SetRGBA(0, 0, dst)
+			spanner := scanx.NewImgSpanner(img)
+			spanner.LinearLight = true
+			spanner.SetColor(src)
+			spanner.GetSpanFunc()(0, 0, 1, cov)
+			got1 := img.RGBAAt(0, 0)
+
+			// the same source through a color function
+			img.SetRGBA(0, 0, dst)
+			spanner.SetColor(rasterx.ColorFunc(func(x, y int) color.Color { return src }))
+			spanner.GetSpanFunc()(0, 0, 1, cov)
+			got2 := img.RGBAAt(0, 0)
+
+			lspanner := &scanx.LinkListSpanner{}
+			lspanner.SetBounds(bounds)
+			lspanner.LinearLight = true
+			lspanner.SetBgColor(dst)
+			lspanner.SetColor(src)
+			lspanner.GetSpanFunc()(0, 0, 1, cov)
+			lspanner.DrawToImage(img)
+			got3 := img.RGBAAt(0, 0)
+
+			for _, got := range []color.RGBA{got1, got2, got3} {
+				if got.A != 0xFF {
+					t.Errorf("%v over %v at %#x: alpha %d, want opaque", src, dst, cov, got.A)
+				}
+				for k, v := range [3]uint8{got.R, got.G, got.B} {
+					if d := float64(v) - want[k]; d < -2 || d > 2 {
+						t.Errorf("%v over %v at %#x gave %v, want %v", src, dst, cov, got, want)
+						break
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestLinearLightSpanners(t *testing.T) {
+	width := 200
+	height := 175
+
+	img1 := image.NewRGBA(image.Rect(0, 0, width, height))
+	img2 := image.NewRGBA(image.Rect(0, 0, width, height))
+	svgs, err := FilePathWalkDir("testdata/svg/landscapeIcons")
+	if err != nil {
+		t.Fatal("cannot walk file path testdata/svg/landscapeIcons")
+	}
+	for _, f := range svgs {
+		Clear(img1)
+		Clear(img2)
+		RenderLinkList(t, f, width, height, func(s *scanx.LinkListSpanner) {
+			s.LinearLight = true
+		}).DrawToImage(img1)
+		RenderImg(t, f, img2, func(s *scanx.ImgSpanner) {
+			s.LinearLight = true
+		})
+		if d := MaxPixDiff(img1, img2); d != 0 {
+			t.Errorf("%s: spanners differ by %d", f, d)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package scanx
+
+import "image"
+
+// MaskMode selects the mask value taken from each pixel of a mask image.
+type MaskMode int
+
+const (
+	// AlphaMask uses the alpha channel of the mask.
+	AlphaMask MaskMode = iota
+	// LuminanceMask uses the luminance of the premultiplied mask color, as
+	// for an SVG mask, so transparent and black pixels both mask fully.
+	LuminanceMask
+)
+
+// Luminance weights of the SVG luminanceToAlpha filter scaled to 1<<16.
+const (
+	lumR = 13926
+	lumG = 46884
+	lumB = 4726
+)
+
+// MaskSpanner is a Spanner that multiplies the coverage of every span by the
+// values of a mask image before forwarding it to another Spanner, for SVG
+// masks and fade outs. Span pixel (x, y) is masked by the mask pixel at
+// (x-Offset.X, y-Offset.Y), and pixels outside of the mask bounds are
+// masked out completely. Spans are divided into runs of equal masked
+// coverage, and runs of zero coverage are not forwarded.
+type MaskSpanner struct {
+	Spanner Spanner
+	Mask    image.Image
+	Mode    MaskMode
+	Offset  image.Point
+	row     []uint32
+}
+
+// NewMaskSpanner returns a MaskSpanner that masks the spans of s with mask.
+func NewMaskSpanner(s Spanner, mask image.Image, mode MaskMode) *MaskSpanner {
+	return &MaskSpanner{Spanner: s, Mask: mask, Mode: mode}
+}
+
+// SetColor sets the color of the masked Spanner.
+func (x *MaskSpanner) SetColor(c interface{}) {
+	x.Spanner.SetColor(c)
+}
+
+// GetSpanFunc returns the function that consumes a span described by the parameters.
+func (x *MaskSpanner) GetSpanFunc() SpanFunc {
+	f := x.Spanner.GetSpanFunc()
+	return func(yi, xi0, xi1 int, ma uint32) {
+		row := x.maskRow(yi, xi0, xi1)
+		run, runMa := xi0, uint32(0)
+		for i, v := range row {
+			cma := (ma*v + m/2) / m
+			if cma != runMa {
+				if runMa != 0 {
+					f(yi, run, xi0+i, runMa)
+				}
+				run, runMa = xi0+i, cma
+			}
+		}
+		if runMa != 0 {
+			f(yi, run, xi1, runMa)
+		}
+	}
+}
+
+// maskRow returns the 16 bit mask values of the span pixels from xi0 to xi1 of row yi.
+func (x *MaskSpanner) maskRow(yi, xi0, xi1 int) []uint32 {
+	n := xi1 - xi0
+	if cap(x.row) < n {
+		x.row = make([]uint32, n)
+	}
+	row := x.row[:n]
+	for i := range row {
+		row[i] = 0
+	}
+	b := x.Mask.Bounds()
+	my := yi - x.Offset.Y
+	mx0, mx1 := xi0-x.Offset.X, xi1-x.Offset.X
+	if my < b.Min.Y || my >= b.Max.Y || mx1 <= b.Min.X || mx0 >= b.Max.X {
+		return row
+	}
+	// limit the span to the mask bounds; the rest stays zero
+	lo, hi := mx0, mx1
+	if lo < b.Min.X {
+		lo = b.Min.X
+	}
+	if hi > b.Max.X {
+		hi = b.Max.X
+	}
+	dst := row[lo-mx0 : hi-mx0]
+	switch mask := x.Mask.(type) {
+	case *image.Alpha:
+		pix := mask.Pix[mask.PixOffset(lo, my):]
+		for i := range dst {
+			dst[i] = uint32(pix[i]) * pa
+		}
+	case *image.RGBA:
+		pix := mask.Pix[mask.PixOffset(lo, my):]
+		if x.Mode == LuminanceMask {
+			for i := range dst {
+				p := pix[i*4 : i*4+3 : i*4+3]
+				dst[i] = (uint32(p[0])*lumR + uint32(p[1])*lumG + uint32(p[2])*lumB) >> 16 * pa
+			}
+			break
+		}
+		for i := range dst {
+			dst[i] = uint32(pix[i*4+3]) * pa
+		}
+	default:
+		for i := range dst {
+			r, g, b, a := mask.At(lo+i, my).RGBA()
+			if x.Mode == LuminanceMask {
+				a = (r*lumR + g*lumG + b*lumB) >> 16
+			}
+			dst[i] = a
+		}
+	}
+	return row
+}
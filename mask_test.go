@@ -0,0 +1,73 @@
+package scanx_test
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/srwiley/scanx"
+)
+
+// opaqueImage hides the concrete type of an image, so that the
+// MaskSpanner takes its general path.
+type opaqueImage struct{ image.Image }
+
+func TestMaskSpanner(t *testing.T) {
+	bounds := image.Rect(0, 0, 40, 10)
+	alpha := image.NewAlpha(image.Rect(0, 0, 32, 6))
+	rgba := image.NewRGBA(alpha.Rect)
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 32; x++ {
+			v := uint8(x * 8)
+			alpha.SetAlpha(x, y, color.Alpha{v})
+			rgba.SetRGBA(x, y, color.RGBA{v / 2, v, v / 4, v})
+		}
+	}
+	red := color.RGBA{0xFF, 0, 0, 0xFF}
+	draw := func(s scanx.Spanner) {
+		s.SetColor(red)
+		f := s.GetSpanFunc()
+		for y := 0; y < 10; y++ {
+			f(y, 0, 40, 0xFFFF)
+		}
+	}
+	for _, mode := range []scanx.MaskMode{scanx.AlphaMask, scanx.LuminanceMask} {
+		for _, mask := range []image.Image{alpha, rgba} {
+			img1 := image.NewRGBA(bounds)
+			ms := scanx.NewMaskSpanner(scanx.NewImgSpanner(img1), mask, mode)
+			ms.Offset = image.Pt(4, 2)
+			draw(ms)
+
+			img2 := image.NewRGBA(bounds)
+			ms.Spanner = scanx.NewImgSpanner(img2)
+			ms.Mask = opaqueImage{mask}
+			draw(ms)
+			if d := MaxPixDiff(img1, img2); d > 1 {
+				t.Errorf("mode %d %T: fast path differs from general path by %d", mode, mask, d)
+			}
+
+			img3 := image.NewRGBA(bounds)
+			lspanner := &scanx.LinkListSpanner{}
+			lspanner.SetBounds(bounds)
+			ms.Spanner, ms.Mask = lspanner, mask
+			draw(ms)
+			lspanner.DrawToImage(img3)
+			if d := MaxPixDiff(img1, img3); d != 0 {
+				t.Errorf("mode %d %T: ImgSpanner and LinkListSpanner differ by %d", mode, mask, d)
+			}
+
+			for _, p := range []image.Point{{2, 4}, {20, 1}, {20, 9}, {38, 4}} {
+				if got := img1.RGBAAt(p.X, p.Y); got != (color.RGBA{}) {
+					t.Errorf("mode %d %T: pixel %v outside of the mask is %v", mode, mask, p, got)
+				}
+			}
+			want := uint8(10 * 8)
+			if mode == scanx.LuminanceMask && mask == image.Image(rgba) {
+				want = 68 // 0.2125*40 + 0.7154*80 + 0.0721*20
+			}
+			if got := img1.RGBAAt(14, 4); got.A < want-1 || got.A > want+1 || got.R != got.A {
+				t.Errorf("mode %d %T: masked pixel is %v, want alpha %d", mode, mask, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package scanx_test
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/srwiley/scanx"
+)
+
+// checkRect reports the pixels of img that differ from want inside of r
+// or that are not transparent outside of it.
+func checkRect(t *testing.T, name string, img image.Image, r image.Rectangle, want color.RGBA) {
+	t.Helper()
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			w := color.RGBA{}
+			if (image.Point{x, y}).In(r) {
+				w = want
+			}
+			if got := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA); got != w {
+				t.Errorf("%s: pixel (%d, %d) is %v, want %v", name, x, y, got, w)
+				return
+			}
+		}
+	}
+}
+
+func TestImgSpannerOffset(t *testing.T) {
+	red := color.RGBA{0xFF, 0, 0, 0xFF}
+	// an image whose bounds do not start at the origin
+	img := image.NewRGBA(image.Rect(10, 20, 30, 40))
+	fillRect(scanx.NewImgSpanner(img), red, image.Rect(5, 25, 15, 35))
+	checkRect(t, "offset image", img, image.Rect(10, 25, 15, 35), red)
+
+	// a sub image only changes the pixels it covers in the parent
+	parent := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	sub := parent.SubImage(image.Rect(8, 8, 16, 16)).(*image.RGBA)
+	fillRect(scanx.NewImgSpanner(sub), red, image.Rect(0, 12, 40, 40))
+	checkRect(t, "sub image", parent, image.Rect(8, 12, 16, 16), red)
+
+	parent16 := scanx.NewPacked16Image(image.Rect(0, 0, 40, 40), scanx.ARGB4444, false)
+	fillRect(scanx.NewPacked16Spanner(parent16.SubImage(image.Rect(4, 4, 12, 12))), red, image.Rect(0, 8, 40, 40))
+	checkRect(t, "packed16 sub image", parent16, image.Rect(4, 8, 12, 12), red)
+}
+
+func TestDrawToImageAt(t *testing.T) {
+	blue := color.RGBA{0, 0, 0xFF, 0xFF}
+	// an icon with a transparent border in spanner bounds away from the origin
+	lspanner := &scanx.LinkListSpanner{}
+	lspanner.SetBounds(image.Rect(100, 200, 110, 210))
+	fillRect(lspanner, blue, image.Rect(102, 202, 108, 208))
+
+	img := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	lspanner.DrawToImage(img)
+	checkRect(t, "outside of image", img, image.Rectangle{}, blue)
+
+	// stamp the icon at several positions, including clipped ones
+	for _, pt := range []image.Point{{0, 0}, {20, 5}, {35, 35}, {-4, 30}} {
+		lspanner.DrawToImageAt(img, pt)
+	}
+	want := image.NewRGBA(img.Rect)
+	for _, pt := range []image.Point{{0, 0}, {20, 5}, {35, 35}, {-4, 30}} {
+		draw.Draw(want, image.Rect(2, 2, 8, 8).Add(pt), image.NewUniform(blue), image.Point{}, draw.Src)
+	}
+	if d := MaxPixDiff(img, want); d != 0 {
+		t.Errorf("DrawToImageAt differs by %d", d)
+	}
+
+	// the same through a sub image and the generic draw.Image path
+	for _, dst := range []draw.Image{
+		image.NewRGBA(image.Rect(0, 0, 40, 40)).SubImage(image.Rect(16, 0, 40, 24)).(draw.Image),
+		image.NewNRGBA(image.Rect(16, 0, 40, 24)),
+		scanx.NewPacked16Image(image.Rect(16, 0, 40, 24), scanx.ARGB4444, false),
+		image.NewPaletted(image.Rect(16, 0, 40, 24), color.Palette{color.RGBA{}, blue}),
+	} {
+		lspanner.DrawToImageAt(dst, image.Point{20, 5})
+		checkRect(t, "stamp", dst, image.Rect(22, 7, 28, 13), blue)
+	}
+}
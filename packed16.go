@@ -0,0 +1,387 @@
+package scanx
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/srwiley/rasterx"
+)
+
+// Format16 identifies the bit layout of a packed 16-bit pixel.
+type Format16 int
+
+const (
+	// RGB565 packs 5 bits of red, 6 of green and 5 of blue. It has no alpha,
+	// so every pixel is opaque.
+	RGB565 Format16 = iota
+	// ARGB4444 packs 4 bits each of alpha, red, green and blue. The color
+	// channels are alpha-premultiplied, like image.RGBA.
+	ARGB4444
+	// ARGB1555 packs 1 bit of alpha and 5 bits each of red, green and blue.
+	ARGB1555
+)
+
+type (
+	// Packed16Image is an in-memory image of packed 16-bit pixels, as used by
+	// SPI LCD panels and other embedded displays. Each pixel occupies two
+	// consecutive bytes of Pix in the byte order given by BigEndian.
+	Packed16Image struct {
+		Pix       []uint8
+		Stride    int
+		Rect      image.Rectangle
+		Format    Format16
+		BigEndian bool
+	}
+
+	// Packed16Spanner is a Spanner that composites spans directly into a
+	// *Packed16Image. Like ImgSpanner, it uses either a Paint as the color
+	// source, or a fgColor if paint is nil, and supports the same
+	// compositing operators and blend modes. Color functions are wrapped as
+	// a ColorFuncPaint.
+	Packed16Spanner struct {
+		baseSpanner
+		pix       []uint8
+		stride    int
+		format    Format16
+		bigEndian bool
+		// offset is added to pixel indices, so that spans are drawn
+		// with image coordinates
+		offset int
+		// Dither selects the quantization of the 8-bit channels into the
+		// packed pixel. Only NoDither and OrderedDither apply.
+		Dither DitherMode
+	}
+)
+
+// NewPacked16Image returns a new Packed16Image with the given bounds and layout.
+func NewPacked16Image(r image.Rectangle, f Format16, bigEndian bool) *Packed16Image {
+	return &Packed16Image{
+		Pix:       make([]uint8, 2*r.Dx()*r.Dy()),
+		Stride:    2 * r.Dx(),
+		Rect:      r,
+		Format:    f,
+		BigEndian: bigEndian,
+	}
+}
+
+// pack converts a premultiplied color into the packed pixel value, using
+// bias as the quantization bias for every channel.
+func (f Format16) pack(c color.RGBA, bias uint32) uint16 {
+	r, g, b, a := uint32(c.R), uint32(c.G), uint32(c.B), uint32(c.A)
+	switch f {
+	case ARGB4444:
+		a4 := quantize(a, 16, bias)
+		r4, g4, b4 := quantize(r, 16, bias), quantize(g, 16, bias), quantize(b, 16, bias)
+		// dithering the channels independently may break premultiplication
+		r4, g4, b4 = minU32(r4, a4), minU32(g4, a4), minU32(b4, a4)
+		return uint16(a4<<12 | r4<<8 | g4<<4 | b4)
+	case ARGB1555:
+		if quantize(a, 2, bias) == 0 {
+			return 0
+		}
+		if a != 0xFF { // one bit of alpha holds the straight color
+			r, g, b = r*0xFF/a, g*0xFF/a, b*0xFF/a
+		}
+		return uint16(1<<15 | quantize(r, 32, bias)<<10 | quantize(g, 32, bias)<<5 | quantize(b, 32, bias))
+	default:
+		return uint16(quantize(r, 32, bias)<<11 | quantize(g, 64, bias)<<5 | quantize(b, 32, bias))
+	}
+}
+
+// unpack converts a packed pixel value to a premultiplied color.
+func (f Format16) unpack(v uint16) color.RGBA {
+	p := uint32(v)
+	switch f {
+	case ARGB4444:
+		return color.RGBA{
+			R: uint8((p >> 8 & 0xF) * 0x11),
+			G: uint8((p >> 4 & 0xF) * 0x11),
+			B: uint8((p & 0xF) * 0x11),
+			A: uint8((p >> 12) * 0x11)}
+	case ARGB1555:
+		if p>>15 == 0 {
+			return color.RGBA{}
+		}
+		return color.RGBA{
+			R: expand5(p >> 10 & 0x1F),
+			G: expand5(p >> 5 & 0x1F),
+			B: expand5(p & 0x1F),
+			A: 0xFF}
+	default:
+		g6 := p >> 5 & 0x3F
+		return color.RGBA{
+			R: expand5(p >> 11),
+			G: uint8(g6<<2 | g6>>4),
+			B: expand5(p & 0x1F),
+			A: 0xFF}
+	}
+}
+
+// Model returns the color model of pixels in the format f.
+func (f Format16) Model() color.Model {
+	return color.ModelFunc(func(c color.Color) color.Color {
+		return f.unpack(f.pack(getColorRGBA(c), roundBias))
+	})
+}
+
+func expand5(v uint32) uint8 {
+	return uint8(v<<3 | v>>2)
+}
+
+func minU32(a, b uint32) uint32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// load returns the packed pixel at byte offset i of pix.
+func load16(pix []uint8, i int, bigEndian bool) uint16 {
+	if bigEndian {
+		return uint16(pix[i])<<8 | uint16(pix[i+1])
+	}
+	return uint16(pix[i+1])<<8 | uint16(pix[i])
+}
+
+// store16 writes the packed pixel v at byte offset i of pix.
+func store16(pix []uint8, i int, v uint16, bigEndian bool) {
+	if bigEndian {
+		pix[i], pix[i+1] = uint8(v>>8), uint8(v)
+		return
+	}
+	pix[i], pix[i+1] = uint8(v), uint8(v>>8)
+}
+
+// ColorModel returns the image's color model.
+func (p *Packed16Image) ColorModel() color.Model {
+	return p.Format.Model()
+}
+
+// Bounds returns the domain for which At can return non-zero color.
+func (p *Packed16Image) Bounds() image.Rectangle {
+	return p.Rect
+}
+
+// PixOffset returns the index of the first byte of Pix that corresponds to
+// the pixel at (x, y).
+func (p *Packed16Image) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*2
+}
+
+// At returns the color of the pixel at (x, y).
+func (p *Packed16Image) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return color.RGBA{}
+	}
+	return p.Format.unpack(load16(p.Pix, p.PixOffset(x, y), p.BigEndian))
+}
+
+// Set sets the pixel at (x, y) to c, rounded to the nearest packed value.
+func (p *Packed16Image) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	store16(p.Pix, p.PixOffset(x, y), p.Format.pack(getColorRGBA(c), roundBias), p.BigEndian)
+}
+
+// SubImage returns an image representing the portion of the image p visible
+// through r. The returned value shares pixels with the original image.
+func (p *Packed16Image) SubImage(r image.Rectangle) *Packed16Image {
+	r = r.Intersect(p.Rect)
+	if r.Empty() {
+		return &Packed16Image{Format: p.Format, BigEndian: p.BigEndian}
+	}
+	i := p.PixOffset(r.Min.X, r.Min.Y)
+	return &Packed16Image{
+		Pix:       p.Pix[i:],
+		Stride:    p.Stride,
+		Rect:      r,
+		Format:    p.Format,
+		BigEndian: p.BigEndian,
+	}
+}
+
+// NewPacked16Spanner returns a Packed16Spanner set to draw to the img.
+func NewPacked16Spanner(img *Packed16Image) (x *Packed16Spanner) {
+	x = &Packed16Spanner{}
+	x.SetImage(img)
+	return
+}
+
+// SetImage sets the image that the Packed16Spanner will draw onto
+func (x *Packed16Spanner) SetImage(img *Packed16Image) {
+	x.pix = img.Pix
+	x.stride = img.Stride
+	x.format = img.Format
+	x.bigEndian = img.BigEndian
+	x.bounds = img.Bounds()
+	x.offset = pixOrigin(x.stride, 2, x.bounds, image.Point{})
+	x.clip = x.bounds
+}
+
+// SetColor sets the color of x to a color.Color, a rasterx.ColorFunction
+// or a Paint.
+func (x *Packed16Spanner) SetColor(c interface{}) {
+	switch c := c.(type) {
+	case Paint:
+		x.paint = preparePaint(c)
+	case color.Color:
+		x.paint = nil
+		x.fgColor = getColorRGBA(c)
+	case rasterx.ColorFunc:
+		x.paint = ColorFuncPaint(c)
+	}
+}
+
+// GetSpanFunc returns the function that consumes a span described by the parameters.
+func (x *Packed16Spanner) GetSpanFunc() SpanFunc {
+	return x.withClip(x.withOpacity(x.spanFunc()))
+}
+
+// spanFunc selects the span function for the color source and compositing settings.
+func (x *Packed16Spanner) spanFunc() SpanFunc {
+	var (
+		usePaint = x.paint != nil
+		fast     = x.fastOp()
+		drawOver = fast && x.compositeOp() == SrcOver
+		drawSrc  = fast && x.compositeOp() == Src
+	)
+	switch {
+	case usePaint && drawOver:
+		return x.SpanPaint
+	case usePaint && drawSrc:
+		return x.SpanPaintR
+	case usePaint:
+		return x.SpanPaintOp
+	case drawOver:
+		return x.SpanFgColor
+	case drawSrc:
+		return x.SpanFgColorR
+	default:
+		return x.SpanFgColorOp
+	}
+}
+
+// fill writes the color c to the pixels from i0 to i1 of row yi, starting at column xi0.
+func (x *Packed16Spanner) fill(yi, xi0, i0, i1 int, c color.RGBA) {
+	var biases [4]uint32
+	ditherRow(x.Dither, yi, &biases)
+	var vals [4]uint16
+	for k := range vals {
+		vals[k] = x.format.pack(c, biases[k])
+	}
+	cx := xi0
+	for i := i0; i < i1; i += 2 {
+		store16(x.pix, i, vals[cx&3], x.bigEndian)
+		cx++
+	}
+}
+
+// SpanFgColorR draws the span with the fore ground color and replaces the previous values.
+func (x *Packed16Spanner) SpanFgColorR(yi, xi0, xi1 int, ma uint32) {
+	i0 := yi*x.stride + xi0*2 + x.offset
+	i1 := i0 + (xi1-xi0)*2
+	cr, cg, cb, ca := x.fgColor.RGBA()
+	x.fill(yi, xi0, i0, i1, color.RGBA{
+		uint8(cr * ma / mp),
+		uint8(cg * ma / mp),
+		uint8(cb * ma / mp),
+		uint8(ca * ma / mp)})
+}
+
+// SpanFgColor draws the span using the fore ground color and the Porter-Duff composition operator.
+func (x *Packed16Spanner) SpanFgColor(yi, xi0, xi1 int, ma uint32) {
+	i0 := yi*x.stride + xi0*2 + x.offset
+	i1 := i0 + (xi1-xi0)*2
+	cr, cg, cb, ca := x.fgColor.RGBA()
+	ama := ca * ma
+	if ama == 0xFFFF*0xFFFF { // undercolor is ignored
+		x.fill(yi, xi0, i0, i1, color.RGBA{
+			uint8(cr * ma / mp),
+			uint8(cg * ma / mp),
+			uint8(cb * ma / mp),
+			uint8(ama / mp)})
+		return
+	}
+	rma := cr * ma
+	gma := cg * ma
+	bma := cb * ma
+	a := (m - (ama / m)) * pa
+	cx := xi0
+	for i := i0; i < i1; i += 2 {
+		d := x.format.unpack(load16(x.pix, i, x.bigEndian))
+		c := color.RGBA{
+			uint8((uint32(d.R)*a + rma) / mp),
+			uint8((uint32(d.G)*a + gma) / mp),
+			uint8((uint32(d.B)*a + bma) / mp),
+			uint8((uint32(d.A)*a + ama) / mp)}
+		store16(x.pix, i, x.format.pack(c, ditherBias(x.Dither, cx, yi)), x.bigEndian)
+		cx++
+	}
+}
+
+// SpanFgColorOp draws the span using the fore ground color and the general compositing settings of x.
+func (x *Packed16Spanner) SpanFgColorOp(yi, xi0, xi1 int, ma uint32) {
+	i0 := yi*x.stride + xi0*2 + x.offset
+	i1 := i0 + (xi1-xi0)*2
+	cr, cg, cb, ca := x.fgColor.RGBA()
+	cx := xi0
+	for i := i0; i < i1; i += 2 {
+		x.compositePacked(i, cx, yi, cr, cg, cb, ca, ma)
+		cx++
+	}
+}
+
+// SpanPaintR draws the span using the paint and replaces the previous values.
+func (x *Packed16Spanner) SpanPaintR(yi, xi0, xi1 int, ma uint32) {
+	i := yi*x.stride + xi0*2 + x.offset
+	cx := xi0
+	for _, c := range x.paintSpan(yi, xi0, xi1) {
+		rc := color.RGBA{
+			uint8(uint32(c.R) * ma / mp),
+			uint8(uint32(c.G) * ma / mp),
+			uint8(uint32(c.B) * ma / mp),
+			uint8(uint32(c.A) * ma / mp)}
+		store16(x.pix, i, x.format.pack(rc, ditherBias(x.Dither, cx, yi)), x.bigEndian)
+		i += 2
+		cx++
+	}
+}
+
+// SpanPaint draws the span using the paint and the Porter-Duff composition operator.
+func (x *Packed16Spanner) SpanPaint(yi, xi0, xi1 int, ma uint32) {
+	i := yi*x.stride + xi0*2 + x.offset
+	cx := xi0
+	for _, c := range x.paintSpan(yi, xi0, xi1) {
+		rcr, rcg, rcb, rca := uint32(c.R), uint32(c.G), uint32(c.B), uint32(c.A)
+		a := (m - (rca * ma / m)) * pa
+		d := x.format.unpack(load16(x.pix, i, x.bigEndian))
+		rc := color.RGBA{
+			uint8((uint32(d.R)*a + rcr*ma) / mp),
+			uint8((uint32(d.G)*a + rcg*ma) / mp),
+			uint8((uint32(d.B)*a + rcb*ma) / mp),
+			uint8((uint32(d.A)*a + rca*ma) / mp)}
+		store16(x.pix, i, x.format.pack(rc, ditherBias(x.Dither, cx, yi)), x.bigEndian)
+		i += 2
+		cx++
+	}
+}
+
+// SpanPaintOp draws the span using the paint and the general compositing settings of x.
+func (x *Packed16Spanner) SpanPaintOp(yi, xi0, xi1 int, ma uint32) {
+	i := yi*x.stride + xi0*2 + x.offset
+	cx := xi0
+	for _, c := range x.paintSpan(yi, xi0, xi1) {
+		x.compositePacked(i, cx, yi, uint32(c.R), uint32(c.G), uint32(c.B), uint32(c.A), ma)
+		i += 2
+		cx++
+	}
+}
+
+// compositePacked composites the premultiplied 16 bit source onto the
+// packed pixel at pix[i], which is column cx of row yi, with coverage ma.
+func (x *Packed16Spanner) compositePacked(i, cx, yi int, sr, sg, sb, sa, ma uint32) {
+	d := x.format.unpack(load16(x.pix, i, x.bigEndian))
+	c := x.compositeRGBA16(sr, sg, sb, sa, d, ma)
+	store16(x.pix, i, x.format.pack(c, ditherBias(x.Dither, cx, yi)), x.bigEndian)
+}
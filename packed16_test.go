@@ -0,0 +1,194 @@
+package scanx_test
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+	"github.com/srwiley/scanx"
+)
+
+var formats16 = []scanx.Format16{scanx.RGB565, scanx.ARGB4444, scanx.ARGB1555}
+
+func TestPacked16Layout(t *testing.T) {
+	r := image.Rect(0, 0, 2, 1)
+	for _, be := range []bool{false, true} {
+		img := scanx.NewPacked16Image(r, scanx.RGB565, be)
+		img.Set(1, 0, color.RGBA{0xFF, 0, 0, 0xFF})
+		hi, lo := img.Pix[2], img.Pix[3]
+		if !be {
+			hi, lo = lo, hi
+		}
+		if hi != 0xF8 || lo != 0 {
+			t.Errorf("big endian %v: red pixel bytes % x", be, img.Pix[2:4])
+		}
+		if c := img.At(1, 0); c != (color.RGBA{0xFF, 0, 0, 0xFF}) {
+			t.Errorf("big endian %v: red pixel reads back as %v", be, c)
+		}
+	}
+	img := scanx.NewPacked16Image(r, scanx.ARGB4444, false)
+	img.Set(0, 0, color.RGBA{0x44, 0x22, 0, 0x88})
+	if v := uint16(img.Pix[1])<<8 | uint16(img.Pix[0]); v != 0x8420 {
+		t.Errorf("ARGB4444 pixel %#04x, want 0x8420", v)
+	}
+}
+
+func TestPacked16LinkList(t *testing.T) {
+	width, height := 200, 175
+	bounds := image.Rect(0, 0, width, height)
+	rgba := image.NewRGBA(bounds)
+	svgs, err := FilePathWalkDir("testdata/svg/landscapeIcons")
+	if err != nil {
+		t.Fatal("cannot walk file path testdata/svg/landscapeIcons")
+	}
+	for _, f := range svgs {
+		icon, errSvg := oksvg.ReadIcon(f, oksvg.WarnErrorMode)
+		if errSvg != nil {
+			t.Fatal("cannot read icon", errSvg)
+		}
+		icon.SetTarget(0, 0, float64(width), float64(height))
+		spanner := &scanx.LinkListSpanner{}
+		spanner.SetBounds(bounds)
+		raster := rasterx.NewDasher(width, height, scanx.NewScanner(spanner, width, height))
+		icon.Draw(raster, 1.0)
+		Clear(rgba)
+		spanner.DrawToImage(rgba)
+		for _, format := range formats16 {
+			for _, be := range []bool{false, true} {
+				img := scanx.NewPacked16Image(bounds, format, be)
+				spanner.DrawToImage(img)
+				model := img.ColorModel()
+				for y := 0; y < height; y++ {
+					for x := 0; x < width; x++ {
+						want := model.Convert(rgba.At(x, y))
+						if got := img.At(x, y); got != want {
+							t.Fatalf("%s format %d: pixel %d,%d is %v, want %v", f, format, x, y, got, want)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestPacked16Spanner(t *testing.T) {
+	width, height := 200, 175
+	bounds := image.Rect(0, 0, width, height)
+	rgba := image.NewRGBA(bounds)
+	icon, errSvg := oksvg.ReadIcon("testdata/svg/landscapeIcons/beach.svg", oksvg.WarnErrorMode)
+	if errSvg != nil {
+		t.Fatal("cannot read icon", errSvg)
+	}
+	icon.SetTarget(0, 0, float64(width), float64(height))
+	spanner := scanx.NewImgSpanner(rgba)
+	icon.Draw(rasterx.NewDasher(width, height, scanx.NewScanner(spanner, width, height)), 1.0)
+
+	// Intermediate results are requantized after every path, so allow
+	// a few quantization steps of drift.
+	for _, tc := range []struct {
+		format scanx.Format16
+		limit  int
+	}{{scanx.RGB565, 24}, {scanx.ARGB4444, 51}} {
+		for _, dither := range []scanx.DitherMode{scanx.NoDither, scanx.OrderedDither} {
+			img := scanx.NewPacked16Image(bounds, tc.format, true)
+			spanner16 := scanx.NewPacked16Spanner(img)
+			spanner16.Dither = dither
+			icon.Draw(rasterx.NewDasher(width, height, scanx.NewScanner(spanner16, width, height)), 1.0)
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					c1 := rgba.RGBAAt(x, y)
+					c2 := img.At(x, y).(color.RGBA)
+					if tc.format == scanx.RGB565 && c1.A != 0xFF {
+						continue // no alpha channel to compare against
+					}
+					for _, d := range []int{
+						int(c1.R) - int(c2.R), int(c1.G) - int(c2.G),
+						int(c1.B) - int(c2.B), int(c1.A) - int(c2.A)} {
+						if d < -tc.limit || d > tc.limit {
+							t.Fatalf("format %d dither %d: pixel %d,%d is %v, want near %v",
+								tc.format, dither, x, y, c2, c1)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestPacked16Dither(t *testing.T) {
+	const size = 16
+	bounds := image.Rect(0, 0, size, size)
+	gray := color.RGBA{0x84, 0x84, 0x84, 0xFF}
+	mean := func(dither scanx.DitherMode) float64 {
+		img := scanx.NewPacked16Image(bounds, scanx.RGB565, false)
+		spanner := scanx.NewPacked16Spanner(img)
+		spanner.Dither = dither
+		spanner.SetColor(gray)
+		span := spanner.GetSpanFunc()
+		for y := 0; y < size; y++ {
+			span(y, 0, size, 0xFFFF)
+		}
+		sum := 0
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				sum += int(img.At(x, y).(color.RGBA).R)
+			}
+		}
+		return float64(sum) / (size * size)
+	}
+	flat, dithered := mean(scanx.NoDither), mean(scanx.OrderedDither)
+	if d := dithered - float64(gray.R); d < -1 || d > 1 {
+		t.Errorf("dithered mean %v, want near %v (undithered %v)", dithered, gray.R, flat)
+	}
+}
+
+func TestPacked16Paint(t *testing.T) {
+	// paints and compositing settings draw as ImgSpanner does, up to the
+	// ARGB4444 quantization
+	bounds := image.Rect(0, 0, 64, 48)
+	lg := scanx.NewLinearGradient(0, 0, 64, 48, gradientStops...)
+	for _, tc := range []struct {
+		name  string
+		setup func(s scanx.Spanner, b *scanx.BlendMode)
+	}{
+		{"gradient", func(s scanx.Spanner, b *scanx.BlendMode) { s.SetColor(lg) }},
+		{"gradient multiply", func(s scanx.Spanner, b *scanx.BlendMode) {
+			s.SetColor(lg)
+			*b = scanx.BlendMultiply
+		}},
+		{"color multiply", func(s scanx.Spanner, b *scanx.BlendMode) {
+			s.SetColor(color.RGBA{0x80, 0x40, 0, 0xC0})
+			*b = scanx.BlendMultiply
+		}},
+	} {
+		rgba := image.NewRGBA(bounds)
+		img := scanx.NewPacked16Image(bounds, scanx.ARGB4444, false)
+		spanner := scanx.NewImgSpanner(rgba)
+		spanner16 := scanx.NewPacked16Spanner(img)
+		for _, s := range []scanx.Spanner{spanner, spanner16} {
+			fillRect(s, color.RGBA{0x30, 0x60, 0x90, 0xFF}, image.Rect(0, 0, 64, 48))
+		}
+		tc.setup(spanner, &spanner.Blend)
+		tc.setup(spanner16, &spanner16.Blend)
+		for _, s := range []scanx.Spanner{spanner, spanner16} {
+			f := s.GetSpanFunc()
+			for y := 8; y < 40; y++ {
+				f(y, 4, 60, 0xFFFF)
+			}
+		}
+		worst := 0
+		for y := 0; y < 48; y++ {
+			for x := 0; x < 64; x++ {
+				c1, c2 := rgba.RGBAAt(x, y), img.At(x, y).(color.RGBA)
+				for _, d := range []int{int(c1.R) - int(c2.R), int(c1.G) - int(c2.G), int(c1.B) - int(c2.B), int(c1.A) - int(c2.A)} {
+					worst = max(worst, d, -d)
+				}
+			}
+		}
+		if worst > 17 {
+			t.Errorf("%s: Packed16Spanner differs from ImgSpanner by %d", tc.name, worst)
+		}
+	}
+}
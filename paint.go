@@ -0,0 +1,62 @@
+package scanx
+
+import (
+	"image/color"
+
+	"github.com/srwiley/rasterx"
+)
+
+type (
+	// Paint is a color source that fills the colors of a whole span at
+	// once, rather than being called for every pixel like a
+	// rasterx.ColorFunc. FillSpan sets dst[:x1-x0] to the alpha-premultiplied
+	// colors of the pixels from x0 to x1 of row y, in the coordinates of the
+	// spanner. Paints can be passed to the SetColor method of ImgSpanner
+	// and LinkListSpanner.
+	Paint interface {
+		FillSpan(y, x0, x1 int, dst []color.RGBA64)
+	}
+
+	// ColorFuncPaint adapts a rasterx.ColorFunc to the Paint interface.
+	// SetColor wraps color functions with it, so existing gradient color
+	// functions continue to work.
+	ColorFuncPaint rasterx.ColorFunc
+
+	// preparer is implemented by paints, like the gradients, that compute
+	// tables from their fields before use. prepared returns a copy of the
+	// paint with the tables computed, so that spanners never write to the
+	// paint passed to SetColor, which may then be shared by spanners in
+	// several goroutines.
+	preparer interface {
+		prepared() Paint
+	}
+)
+
+// FillSpan sets dst[:x1-x0] to the colors returned by the color function.
+func (f ColorFuncPaint) FillSpan(y, x0, x1 int, dst []color.RGBA64) {
+	dst = dst[:x1-x0]
+	for i := range dst {
+		r, g, b, a := f(x0+i, y).RGBA()
+		dst[i] = color.RGBA64{uint16(r), uint16(g), uint16(b), uint16(a)}
+	}
+}
+
+// preparePaint returns p, or a prepared copy of p, ready for use by a spanner.
+func preparePaint(p Paint) Paint {
+	if p, ok := p.(preparer); ok {
+		return p.prepared()
+	}
+	return p
+}
+
+// paintSpan returns the colors of x.paint for the span, using a buffer
+// that is reused from span to span.
+func (x *baseSpanner) paintSpan(yi, xi0, xi1 int) []color.RGBA64 {
+	n := xi1 - xi0
+	if cap(x.paintBuf) < n {
+		x.paintBuf = make([]color.RGBA64, n)
+	}
+	buf := x.paintBuf[:n]
+	x.paint.FillSpan(yi, xi0, xi1, buf)
+	return buf
+}
@@ -0,0 +1,63 @@
+package scanx_test
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/srwiley/rasterx"
+	"github.com/srwiley/scanx"
+)
+
+// checkers is a Paint of 4 by 4 pixel squares of two colors.
+type checkers [2]color.RGBA64
+
+func (c checkers) FillSpan(y, x0, x1 int, dst []color.RGBA64) {
+	for i := range dst[:x1-x0] {
+		dst[i] = c[((x0+i)/4+y/4)&1]
+	}
+}
+
+func TestPaint(t *testing.T) {
+	paint := checkers{{0xFFFF, 0, 0, 0xFFFF}, {0, 0x8000, 0, 0x8000}}
+	colorFunc := rasterx.ColorFunc(func(x, y int) color.Color {
+		return paint[(x/4+y/4)&1]
+	})
+	dst := make([]color.RGBA64, 16)
+	scanx.ColorFuncPaint(colorFunc).FillSpan(5, 3, 19, dst)
+	want := make([]color.RGBA64, 16)
+	paint.FillSpan(5, 3, 19, want)
+	for i := range dst {
+		if dst[i] != want[i] {
+			t.Fatalf("ColorFuncPaint pixel %d gave %v, want %v", i+3, dst[i], want[i])
+		}
+	}
+
+	bounds := image.Rect(0, 0, 32, 16)
+	img1 := image.NewRGBA(bounds)
+	img2 := image.NewRGBA(bounds)
+	img3 := image.NewRGBA(bounds)
+	spanner1 := scanx.NewImgSpanner(img1)
+	spanner1.SetColor(paint)
+	spanner2 := scanx.NewImgSpanner(img2)
+	spanner2.SetColor(colorFunc)
+	lspanner := &scanx.LinkListSpanner{}
+	lspanner.SetBounds(bounds)
+	lspanner.SetColor(paint)
+	for _, s := range []scanx.Spanner{spanner1, spanner2, lspanner} {
+		f := s.GetSpanFunc()
+		for y := 0; y < 16; y++ {
+			f(y, 2, 30, 0xFFFF)
+		}
+	}
+	lspanner.DrawToImage(img3)
+	if d := MaxPixDiff(img1, img2); d != 0 {
+		t.Errorf("paint and color function differ by %d", d)
+	}
+	if d := MaxPixDiff(img1, img3); d != 0 {
+		t.Errorf("ImgSpanner and LinkListSpanner paints differ by %d", d)
+	}
+	if got, want := img1.RGBAAt(6, 1), (color.RGBA{0, 0x80, 0, 0x80}); got != want {
+		t.Errorf("pixel (6, 1) is %v, want %v", got, want)
+	}
+}
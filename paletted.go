@@ -0,0 +1,100 @@
+package scanx
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// paletteMapper caches the palette indices of span colors, so that each
+// distinct span color is matched against the palette only once.
+type paletteMapper struct {
+	palette color.Palette
+	// spread is the amplitude of the ordered dither offsets, roughly the
+	// distance between neighboring palette colors.
+	spread  float64
+	nearest map[color.RGBA]uint8
+	ordered map[color.RGBA]*[16]uint8
+}
+
+func newPaletteMapper(p color.Palette) *paletteMapper {
+	spread := 0.0
+	if len(p) > 1 {
+		spread = 0xFF / math.Cbrt(float64(len(p)))
+	}
+	return &paletteMapper{
+		palette: p,
+		spread:  spread,
+		nearest: make(map[color.RGBA]uint8),
+		ordered: make(map[color.RGBA]*[16]uint8),
+	}
+}
+
+// index returns the palette index nearest to c.
+func (pm *paletteMapper) index(c color.RGBA) uint8 {
+	i, ok := pm.nearest[c]
+	if !ok {
+		i = uint8(pm.palette.Index(c))
+		pm.nearest[c] = i
+	}
+	return i
+}
+
+// levels returns the palette indices for c at each of the 16 Bayer
+// threshold levels.
+func (pm *paletteMapper) levels(c color.RGBA) *[16]uint8 {
+	idx, ok := pm.ordered[c]
+	if ok {
+		return idx
+	}
+	idx = new([16]uint8)
+	for t := range idx {
+		d := ((float64(t)+0.5)/16 - 0.5) * pm.spread
+		idx[t] = pm.index(color.RGBA{
+			R: offsetChannel(c.R, c.A, d),
+			G: offsetChannel(c.G, c.A, d),
+			B: offsetChannel(c.B, c.A, d),
+			A: c.A})
+	}
+	pm.ordered[c] = idx
+	return idx
+}
+
+// offsetChannel adds d to the premultiplied channel v, keeping it within [0, a].
+func offsetChannel(v, a uint8, d float64) uint8 {
+	f := math.Round(float64(v) + d*float64(a)/0xFF)
+	if f < 0 {
+		return 0
+	}
+	if f > float64(a) {
+		return a
+	}
+	return uint8(f)
+}
+
+// spansToPaletted writes the spans of r, translated by d, into img. Each call
+// has its own palette cache, so bands of rows can be written concurrently.
+func (x *LinkListSpanner) spansToPaletted(img *image.Paletted, r image.Rectangle, d image.Point) {
+	pm := newPaletteMapper(img.Palette)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		yo := img.PixOffset(d.X, y+d.Y)
+		for spCell := range x.spans.row(y - x.bounds.Min.Y) {
+			x0, x1 := clipCell(spCell, r)
+			if x0 >= x1 {
+				continue
+			}
+			row := img.Pix[yo+x0 : yo+x1]
+			if x.Dither == OrderedDither {
+				idx, bayer := pm.levels(spCell.clr), &bayer4[(y+d.Y)&3]
+				for i := range row {
+					row[i] = idx[bayer[(x0+d.X+i)&3]]
+				}
+			} else {
+				i := pm.index(spCell.clr)
+				for k := range row {
+					row[k] = i
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package scanx_test
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"testing"
+
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+	"github.com/srwiley/scanx"
+)
+
+func TestPalettedNearest(t *testing.T) {
+	width, height := 200, 175
+	bounds := image.Rect(0, 0, width, height)
+	rgba := image.NewRGBA(bounds)
+	// WebSafe has 216 colors, so index 0xFF marks unwritten pixels.
+	pimg := image.NewPaletted(bounds, palette.WebSafe)
+	svgs, err := FilePathWalkDir("testdata/svg/landscapeIcons")
+	if err != nil {
+		t.Fatal("cannot walk file path testdata/svg/landscapeIcons")
+	}
+	for _, f := range svgs {
+		icon, errSvg := oksvg.ReadIcon(f, oksvg.WarnErrorMode)
+		if errSvg != nil {
+			t.Fatal("cannot read icon", errSvg)
+		}
+		icon.SetTarget(0, 0, float64(width), float64(height))
+		spanner := &scanx.LinkListSpanner{}
+		spanner.SetBounds(bounds)
+		icon.Draw(rasterx.NewDasher(width, height, scanx.NewScanner(spanner, width, height)), 1.0)
+		Clear(rgba)
+		for i := range pimg.Pix {
+			pimg.Pix[i] = 0xFF
+		}
+		spanner.DrawToImage(rgba)
+		spanner.DrawToImage(pimg)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				got := pimg.ColorIndexAt(x, y)
+				if got == 0xFF {
+					if rgba.RGBAAt(x, y).A != 0 {
+						t.Fatalf("%s: pixel %d,%d was not written", f, x, y)
+					}
+					continue
+				}
+				if want := uint8(color.Palette(palette.WebSafe).Index(rgba.At(x, y))); got != want {
+					t.Fatalf("%s: pixel %d,%d has index %d, want %d", f, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestPalettedOrdered(t *testing.T) {
+	const size = 32
+	bounds := image.Rect(0, 0, size, size)
+	gray := color.RGBA{0x70, 0x70, 0x70, 0xFF}
+	pal := color.Palette{color.Black, color.White, color.RGBA{0x55, 0x55, 0x55, 0xFF}, color.RGBA{0xAA, 0xAA, 0xAA, 0xFF}}
+	mean := func(dither scanx.DitherMode) float64 {
+		spanner := &scanx.LinkListSpanner{}
+		spanner.SetBounds(bounds)
+		spanner.Dither = dither
+		spanner.SetColor(gray)
+		span := spanner.GetSpanFunc()
+		for y := 0; y < size; y++ {
+			span(y, 0, size, 0xFFFF)
+		}
+		img := image.NewPaletted(bounds, pal)
+		spanner.DrawToImage(img)
+		sum := 0
+		for _, i := range img.Pix {
+			r, _, _, _ := pal[i].RGBA()
+			sum += int(r >> 8)
+		}
+		return float64(sum) / (size * size)
+	}
+	nearest, ordered := mean(scanx.NoDither), mean(scanx.OrderedDither)
+	if nearest != 0x55 {
+		t.Errorf("nearest mean %v, want %v", nearest, 0x55)
+	}
+	if d := ordered - float64(gray.R); d < -4 || d > 4 {
+		t.Errorf("ordered dither mean %v, want near %v", ordered, gray.R)
+	}
+}
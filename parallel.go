@@ -0,0 +1,72 @@
+package scanx
+
+import (
+	"image"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// defaultParallelMin is the number of pixels below which DrawToImage
+// writes the spans on the calling goroutine when ParallelMin is zero.
+const defaultParallelMin = 256 * 256
+
+// workers returns the number of goroutines that write the spans of r.
+func (x *LinkListSpanner) workers(r image.Rectangle) int {
+	n := x.Workers
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	minPix := x.ParallelMin
+	if minPix <= 0 {
+		minPix = defaultParallelMin
+	}
+	if r.Dx()*r.Dy() < minPix {
+		return 1
+	}
+	if n > r.Dy() {
+		n = r.Dy()
+	}
+	return n
+}
+
+// forRows calls f for bands of rows that together cover r. Rows are
+// independent span lists, so with more than one worker the bands are
+// handed out to a pool of goroutines as each finishes its last band, which
+// balances rows of many spans against empty ones. forRows returns when
+// every band is written.
+func (x *LinkListSpanner) forRows(r image.Rectangle, f func(band image.Rectangle)) {
+	n := x.workers(r)
+	if n <= 1 {
+		f(r)
+		return
+	}
+	// a few bands per worker, so that no worker is left with all the work
+	h := r.Dy() / (n * 4)
+	if h < 1 {
+		h = 1
+	}
+	var (
+		next int32 = int32(r.Min.Y)
+		wg   sync.WaitGroup
+	)
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			for {
+				y := int(atomic.AddInt32(&next, int32(h))) - h
+				if y >= r.Max.Y {
+					return
+				}
+				band := r
+				band.Min.Y = y
+				if y+h < r.Max.Y {
+					band.Max.Y = y + h
+				}
+				f(band)
+			}
+		}()
+	}
+	wg.Wait()
+}
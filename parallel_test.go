@@ -0,0 +1,79 @@
+package scanx_test
+
+import (
+	"bytes"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"testing"
+
+	"github.com/srwiley/scanx"
+)
+
+func TestParallelDrawToImage(t *testing.T) {
+	width, height := 600, 525
+	lspanner := RenderLinkList(t, "testdata/svg/landscapeIcons/sea.svg", width, height, nil)
+	bounds := image.Rect(0, 0, width, height)
+	for _, newImage := range []func() draw.Image{
+		func() draw.Image { return image.NewRGBA(bounds) },
+		func() draw.Image { return scanx.NewPacked16Image(bounds, scanx.RGB565, false) },
+		func() draw.Image { return image.NewPaletted(bounds, palette.WebSafe) },
+	} {
+		lspanner.Workers = 1
+		serial := newImage()
+		lspanner.DrawToImage(serial)
+		for _, workers := range []int{0, 3, 8} {
+			lspanner.Workers, lspanner.ParallelMin = workers, 1
+			parallel := newImage()
+			lspanner.DrawToImageAt(parallel, image.Point{7, -5})
+			want := newImage()
+			draw.Draw(want, bounds, serial, image.Point{-7, 5}, draw.Src)
+			if !bytes.Equal(pixOf(parallel), pixOf(want)) {
+				t.Errorf("%T with %d workers differs from serial", parallel, workers)
+			}
+		}
+	}
+
+	// DrawOverImage uses the same row bands
+	lspanner.Workers, lspanner.ParallelMin = 1, 0
+	serial := backdrop(width, height)
+	lspanner.DrawOverImage(serial)
+	lspanner.Workers, lspanner.ParallelMin = 4, 1
+	parallel := backdrop(width, height)
+	lspanner.DrawOverImage(parallel)
+	if d := MaxPixDiff(serial, parallel); d != 0 {
+		t.Errorf("parallel DrawOverImage differs by %d", d)
+	}
+}
+
+// pixOf returns the pixel bytes of img.
+func pixOf(img draw.Image) []uint8 {
+	switch img := img.(type) {
+	case *image.RGBA:
+		return img.Pix
+	case *image.Paletted:
+		return img.Pix
+	case *scanx.Packed16Image:
+		return img.Pix
+	}
+	return nil
+}
+
+func benchmarkDrawToImage(b *testing.B, workers int) {
+	width, height := 3000, 2625
+	lspanner := RenderLinkList(b, "testdata/svg/landscapeIcons/sea.svg", width, height, nil)
+	lspanner.Workers = workers
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lspanner.DrawToImage(img)
+	}
+}
+
+func BenchmarkDrawToImageSerial(b *testing.B) {
+	benchmarkDrawToImage(b, 1)
+}
+
+func BenchmarkDrawToImageParallel(b *testing.B) {
+	benchmarkDrawToImage(b, 0)
+}
@@ -0,0 +1,296 @@
+package scanx
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"iter"
+)
+
+// The span stream written by WriteTo starts with rleMagic and rleVersion.
+// Then follow the bounds, as varints of Min.X and Min.Y and uvarints of the
+// width and height, and the palette, as a uvarint count of colors followed
+// by the R, G, B and A bytes of each premultiplied color. Then for every row
+// of the bounds from the top there is a uvarint count of spans, followed by
+// three uvarints for each span: the gap from the end of the previous span,
+// or from the left edge of the bounds, the length minus one, and the
+// palette index of the color.
+const (
+	rleMagic   = "SXRL"
+	rleVersion = 1
+	// rleMaxPixels limits the area of the bounds accepted by ReadFrom, so
+	// that a corrupt stream cannot allocate an arbitrarily large spanner.
+	rleMaxPixels = 1 << 28
+)
+
+var (
+	// ErrSpanFormat is returned when reading a span stream that is not valid.
+	ErrSpanFormat = errors.New("scanx: invalid span stream")
+	// ErrSpanVersion is returned when reading a span stream of a newer version.
+	ErrSpanVersion = errors.New("scanx: unsupported span stream version")
+)
+
+// WriteTo writes the accumulated spans and the bounds of x to w in a
+// versioned, run-length encoded binary format, which ReadFrom reads back.
+// Layers must all be popped first, as for DrawToImage. It returns the number
+// of bytes written.
+func (x *LinkListSpanner) WriteTo(w io.Writer) (int64, error) {
+	palette, colors := spanPalette(x.AllSpans())
+	buf := append([]byte(rleMagic), rleVersion)
+	buf = appendBounds(buf, x.bounds)
+	buf = appendPalette(buf, colors)
+	var row []Span
+	for y := x.bounds.Min.Y; y < x.bounds.Max.Y; y++ {
+		row = row[:0]
+		for s := range x.Spans(y) {
+			row = append(row, s)
+		}
+		buf = appendRow(buf, row, x.bounds.Min.X, palette)
+	}
+	n, err := w.Write(buf)
+	return int64(n), err
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.ByteReader
+	n int64
+}
+
+// newCountingReader returns a countingReader of r, which is buffered if it
+// is not an io.ByteReader.
+func newCountingReader(r io.Reader) *countingReader {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &countingReader{r: br}
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	for i := range p {
+		b, err := c.ReadByte()
+		if err != nil {
+			return i, err
+		}
+		p[i] = b
+	}
+	return len(p), nil
+}
+
+// ReadFrom replaces the bounds and spans of x with those of a stream written
+// by WriteTo, after which DrawToImage draws the same pixels as the spanner
+// that wrote it. The other settings of x are kept. If r is not an
+// io.ByteReader, it is buffered and may be read past the end of the stream.
+// It returns the number of bytes read, and ErrSpanFormat or ErrSpanVersion
+// if the stream is not valid, in which case x is unchanged.
+func (x *LinkListSpanner) ReadFrom(r io.Reader) (int64, error) {
+	cr := newCountingReader(r)
+	bounds, rows, err := readSpans(cr)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return cr.n, err
+	}
+	x.SetBounds(bounds)
+	var cells []cell32
+	for i, row := range rows {
+		cells = cells[:0]
+		for _, s := range row {
+			cells = append(cells, cell32{x0: int32(s.X0), x1: int32(s.X1), clr: s.Color})
+		}
+		x.spans.setRow(i, cells)
+	}
+	return cr.n, nil
+}
+
+// ReadLinkListSpanner returns a new LinkListSpanner with the bounds and spans
+// of a stream written by WriteTo.
+func ReadLinkListSpanner(r io.Reader) (*LinkListSpanner, error) {
+	x := &LinkListSpanner{}
+	if _, err := x.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// readSpans decodes a span stream into its bounds and the spans of each row.
+// The counts in the stream are not trusted for allocation, so the palette
+// and rows grow as they are read, and the spanner is only set up once the
+// whole stream is known to be valid.
+func readSpans(r *countingReader) (bounds image.Rectangle, rows [][]Span, err error) {
+	if err = readHeader(r, rleMagic, rleVersion); err != nil {
+		return
+	}
+	if bounds, err = readBounds(r); err != nil {
+		return
+	}
+	colors, err := readPalette(r)
+	if err != nil {
+		return
+	}
+	rows = make([][]Span, 0, min(bounds.Dy(), 1024))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row, err := readRow(r, y, bounds, colors)
+		if err != nil {
+			return bounds, nil, err
+		}
+		rows = append(rows, row)
+	}
+	return bounds, rows, nil
+}
+
+// spanPalette returns the index of each distinct color of spans, in the
+// order of first use, and the colors in that order.
+func spanPalette(spans iter.Seq[Span]) (map[color.RGBA]uint64, []color.RGBA) {
+	palette := make(map[color.RGBA]uint64)
+	var colors []color.RGBA
+	for s := range spans {
+		if _, ok := palette[s.Color]; !ok {
+			palette[s.Color] = uint64(len(colors))
+			colors = append(colors, s.Color)
+		}
+	}
+	return palette, colors
+}
+
+// appendBounds appends the encoded bounds to buf.
+func appendBounds(buf []byte, bounds image.Rectangle) []byte {
+	buf = binary.AppendVarint(buf, int64(bounds.Min.X))
+	buf = binary.AppendVarint(buf, int64(bounds.Min.Y))
+	buf = binary.AppendUvarint(buf, uint64(bounds.Dx()))
+	return binary.AppendUvarint(buf, uint64(bounds.Dy()))
+}
+
+// appendPalette appends the encoded colors to buf.
+func appendPalette(buf []byte, colors []color.RGBA) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(colors)))
+	for _, c := range colors {
+		buf = append(buf, c.R, c.G, c.B, c.A)
+	}
+	return buf
+}
+
+// appendRow appends the encoded spans of a row, which starts at column
+// minX, to buf.
+func appendRow(buf []byte, row []Span, minX int, palette map[color.RGBA]uint64) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(row)))
+	last := minX
+	for _, s := range row {
+		buf = binary.AppendUvarint(buf, uint64(s.X0-last))
+		buf = binary.AppendUvarint(buf, uint64(s.X1-s.X0-1))
+		buf = binary.AppendUvarint(buf, palette[s.Color])
+		last = s.X1
+	}
+	return buf
+}
+
+// readHeader reads the magic and version at the start of a stream.
+func readHeader(r *countingReader, magic string, version byte) error {
+	head := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return err
+	}
+	if string(head[:len(magic)]) != magic {
+		return ErrSpanFormat
+	}
+	if head[len(magic)] != version {
+		return ErrSpanVersion
+	}
+	return nil
+}
+
+// readBounds reads bounds written by appendBounds.
+func readBounds(r *countingReader) (image.Rectangle, error) {
+	var v [4]int64
+	for i := range v {
+		var err error
+		if i < 2 {
+			v[i], err = binary.ReadVarint(r)
+		} else {
+			var u uint64
+			u, err = binary.ReadUvarint(r)
+			v[i] = int64(u)
+			if u > rleMaxPixels {
+				err = ErrSpanFormat
+			}
+		}
+		if err != nil {
+			return image.Rectangle{}, err
+		}
+	}
+	w, h := v[2], v[3]
+	if w*h > rleMaxPixels || v[0] < -1<<31 || v[0]+w > 1<<31 || v[1] < -1<<31 || v[1]+h > 1<<31 {
+		return image.Rectangle{}, ErrSpanFormat
+	}
+	return image.Rect(int(v[0]), int(v[1]), int(v[0]+w), int(v[1]+h)), nil
+}
+
+// readPalette reads colors written by appendPalette.
+func readPalette(r *countingReader) ([]color.RGBA, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	var colors []color.RGBA
+	for ; n > 0; n-- { // grown as read, since n is not trusted
+		var c [4]byte
+		if _, err = io.ReadFull(r, c[:]); err != nil {
+			return nil, err
+		}
+		if c[0] > c[3] || c[1] > c[3] || c[2] > c[3] { // not premultiplied
+			return nil, ErrSpanFormat
+		}
+		colors = append(colors, color.RGBA{c[0], c[1], c[2], c[3]})
+	}
+	return colors, nil
+}
+
+// readRow reads the spans of row y written by appendRow, checking that they
+// lie within bounds.
+func readRow(r *countingReader, y int, bounds image.Rectangle, colors []color.RGBA) ([]Span, error) {
+	w := uint64(bounds.Dx())
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > w {
+		return nil, ErrSpanFormat
+	}
+	var row []Span
+	var last uint64
+	for ; n > 0; n-- {
+		var gap, length, index uint64
+		if gap, err = binary.ReadUvarint(r); err == nil {
+			if length, err = binary.ReadUvarint(r); err == nil {
+				index, err = binary.ReadUvarint(r)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if gap > w || length >= w || index >= uint64(len(colors)) {
+			return nil, ErrSpanFormat
+		}
+		x0 := last + gap
+		x1 := x0 + length + 1
+		if x1 > w {
+			return nil, ErrSpanFormat
+		}
+		row = append(row, Span{Y: y, X0: bounds.Min.X + int(x0), X1: bounds.Min.X + int(x1), Color: colors[index]})
+		last = x1
+	}
+	return row, nil
+}
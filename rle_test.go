@@ -0,0 +1,113 @@
+package scanx_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io"
+	"testing"
+
+	"github.com/srwiley/scanx"
+)
+
+func TestWriteReadSpans(t *testing.T) {
+	width, height := 200, 175
+	lspanner := RenderLinkList(t, "testdata/svg/landscapeIcons/mountains.svg", width, height, nil)
+	var buf bytes.Buffer
+	n, err := lspanner.WriteTo(&buf)
+	if err != nil || n != int64(buf.Len()) {
+		t.Fatalf("WriteTo wrote %d of %d bytes: %v", n, buf.Len(), err)
+	}
+	if buf.Len() >= width*height*4 {
+		t.Errorf("span stream takes %d bytes, more than the pixels", buf.Len())
+	}
+	data := bytes.Clone(buf.Bytes())
+
+	loaded, err := scanx.ReadLinkListSpanner(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal("cannot read spans:", err)
+	}
+	img1 := image.NewRGBA(image.Rect(0, 0, width, height))
+	lspanner.DrawToImage(img1)
+	img2 := image.NewRGBA(image.Rect(0, 0, width, height))
+	loaded.DrawToImage(img2)
+	if d := MaxPixDiff(img1, img2); d != 0 {
+		t.Errorf("loaded spans differ by %d", d)
+	}
+	var again bytes.Buffer
+	if _, err := loaded.WriteTo(&again); err != nil || !bytes.Equal(again.Bytes(), data) {
+		t.Errorf("writing loaded spans gave a different stream")
+	}
+
+	// bounds away from the origin, and a reader that is not an io.ByteReader
+	small := &scanx.LinkListSpanner{}
+	small.SetBounds(image.Rect(-5, 10, 20, 14))
+	fillRect(small, color.RGBA{0x40, 0, 0, 0x80}, image.Rect(-5, 11, 3, 13))
+	buf.Reset()
+	small.WriteTo(&buf)
+	n, err = loaded.ReadFrom(struct{ io.Reader }{&buf})
+	if err != nil || loaded.Bounds() != small.Bounds() {
+		t.Fatalf("ReadFrom gave bounds %v after %d bytes, %v", loaded.Bounds(), n, err)
+	}
+	for y := 10; y < 14; y++ {
+		var got, want []scanx.Span
+		for s := range loaded.Spans(y) {
+			got = append(got, s)
+		}
+		for s := range small.Spans(y) {
+			want = append(want, s)
+		}
+		if len(got) != len(want) || (len(got) > 0 && got[0] != want[0]) {
+			t.Errorf("row %d has spans %v, want %v", y, got, want)
+		}
+	}
+
+	// corrupt streams are rejected, and leave the spanner unchanged
+	for _, tc := range []struct {
+		data []byte
+		err  error
+	}{
+		{[]byte("PNG!"), io.ErrUnexpectedEOF},
+		{[]byte("PNG!\x01"), scanx.ErrSpanFormat},
+		{[]byte("SXRL\x02"), scanx.ErrSpanVersion},
+		{data[:len(data)-1], io.ErrUnexpectedEOF},
+		{[]byte("SXRL\x01\x00\x00\x02\x01\x01\x01\x02\x03\x01\x02\x00\x00\x00"), scanx.ErrSpanFormat}, // not premultiplied
+		{[]byte("SXRL\x01\x00\x00\x02\x01\x01\x01\x02\x03\x03\x01\x01\x01\x00"), scanx.ErrSpanFormat}, // past the bounds
+		{[]byte("SXRL\x01\x00\x00\x02\x01\x01\x01\x02\x03\x03\x01\x00\x00\x01"), scanx.ErrSpanFormat}, // no such color
+	} {
+		if _, err := loaded.ReadFrom(bytes.NewReader(tc.data)); err != tc.err {
+			t.Errorf("reading % x gave %v, want %v", tc.data[:min(len(tc.data), 16)], err, tc.err)
+		}
+	}
+	if loaded.Bounds() != small.Bounds() {
+		t.Errorf("failed read changed the bounds to %v", loaded.Bounds())
+	}
+}
+
+func FuzzReadSpans(f *testing.F) {
+	lspanner := RenderLinkList(f, "testdata/svg/landscapeIcons/sea.svg", 40, 35, nil)
+	var buf bytes.Buffer
+	lspanner.WriteTo(&buf)
+	f.Add(buf.Bytes())
+	f.Add([]byte("SXRL\x01\x00\x00\x02\x01\x01\x01\x02\x03\x03\x01\x00\x00\x00"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		loaded, err := scanx.ReadLinkListSpanner(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		// whatever was accepted must draw and encode again unchanged
+		b := loaded.Bounds()
+		if b.Dx()*b.Dy() <= 1<<16 {
+			loaded.DrawToImage(image.NewRGBA(b))
+		}
+		var again bytes.Buffer
+		loaded.WriteTo(&again)
+		reloaded, err := scanx.ReadLinkListSpanner(&again)
+		if err != nil {
+			t.Fatal("cannot read spans written from a valid stream:", err)
+		}
+		if reloaded.Bounds() != b {
+			t.Fatalf("bounds changed from %v to %v", b, reloaded.Bounds())
+		}
+	})
+}
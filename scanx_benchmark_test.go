@@ -188,3 +188,52 @@ func RunGVScanner(b *testing.B, mult int) {
 		}
 	}
 }
+
+func BenchmarkLinkListSpannerRL(b *testing.B) {
+	RunRL(b, 10, true)
+}
+
+func BenchmarkImgSpannerRL(b *testing.B) {
+	RunRL(b, 10, false)
+}
+
+func BenchmarkLinkListSpannerRL50(b *testing.B) {
+	RunRL(b, 50, true)
+}
+
+func BenchmarkImgSpannerRL50(b *testing.B) {
+	RunRL(b, 50, false)
+}
+
+// RunRL draws rl.svg, whose many overlapping random lines make long span
+// lists, with either the LinkListSpanner or the ImgSpanner.
+func RunRL(b *testing.B, mult int, linkList bool) {
+	icon, errSvg := oksvg.ReadIcon("testdata/svg/rl.svg", oksvg.IgnoreErrorMode)
+	if errSvg != nil {
+		b.Log("cannot read testdata/svg/rl.svg")
+		b.FailNow()
+	}
+	var (
+		wi, hi                 = int(icon.ViewBox.W), int(icon.ViewBox.H)
+		w, h                   = wi * mult / 10, hi * mult / 10
+		bounds                 = image.Rect(0, 0, w, h)
+		img                    = image.NewRGBA(bounds)
+		lspanner               = &scanx.LinkListSpanner{}
+		spanner  scanx.Spanner = scanx.NewImgSpanner(img)
+	)
+	if linkList {
+		lspanner.SetBounds(bounds)
+		spanner = lspanner
+	}
+	raster := rasterx.NewDasher(w, h, scanx.NewScanner(spanner, w, h))
+	icon.SetTarget(0.0, 0.0, float64(w), float64(h))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		icon.Draw(raster, 1.0)
+		if linkList {
+			lspanner.DrawToImage(img)
+			lspanner.Clear()
+		}
+		raster.Clear()
+	}
+}
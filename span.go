@@ -18,118 +18,392 @@ const (
 
 type (
 	spanCell struct {
-		x0, x1, next int
-		clr          color.RGBA
+		x0, x1 int
+		clr    color.RGBA
 	}
 
 	baseSpanner struct {
-		// drawing is done with bounds.Min as the origin
+		// bounds is the area that spans are drawn onto, in the same
+		// coordinates as the spans
 		bounds image.Rectangle
-		// Op is how pixels are overlayed
-		Op      draw.Op
-		fgColor color.RGBA
+		// Op is how pixels are overlayed, draw.Over or draw.Src, when
+		// Composite is DrawOp
+		Op draw.Op
+		// Composite selects any of the Porter-Duff operators, and
+		// overrides Op unless it is DrawOp
+		Composite CompositeOp
+		// Blend mixes the source color with the destination color
+		// before Op is applied
+		Blend BlendMode
+		// LinearLight converts sRGB colors to linear light for blending
+		// and compositing, and back to sRGB for the result.
+		LinearLight bool
+		fgColor     color.RGBA
+		// paint is the color source of non-solid fills; it is used
+		// instead of the fgColor when it is not nil.
+		paint    Paint
+		paintBuf []color.RGBA64
+		// opacity scales the coverage of every span when useOpacity is set
+		opacity    uint32
+		useOpacity bool
+		// spans are clipped to clip, which is the bounds or the
+		// area of the current layer
+		clip image.Rectangle
 	}
 
 	// LinkListSpanner is a Spanner that draws Spans onto a draw.Image
 	// interface satisfying struct but it is optimized for *xgraphics.Image
 	// and *image.RGBA image types
-	// It uses a solid Color only for fg and bg and does not support a color function
-	// used by gradients. Spans are accumulated into a set of linked lists, one for
+	// It uses a solid Color for bg, and either a solid Color or a Paint,
+	// such as a gradient, for fg. Spans are accumulated into a sorted list for
 	// every horizontal line in the image. After the spans for the image are accumulated,
 	// use the DrawToImage function to write the spans to an image.
 	LinkListSpanner struct {
 		baseSpanner
-		spans        []spanCell
-		bgColor      color.RGBA
-		lastY, lastP int
+		spans   spanList
+		bgColor color.RGBA
+		// Dither selects how span colors are quantized by DrawToImage
+		// for image types with fewer bits per channel than color.RGBA,
+		// such as *Packed16Image, *image.Paletted and *Bitmap.
+		Dither DitherMode
+		// threshold is the gray level set by SetThreshold, which is used
+		// instead of 0x80 when useThreshold is set.
+		threshold    uint8
+		useThreshold bool
+		// Workers is the number of goroutines that write rows in DrawToImage
+		// and DrawOverImage. Zero selects runtime.GOMAXPROCS and one writes
+		// every row on the calling goroutine.
+		Workers int
+		// ParallelMin is the number of drawn pixels below which DrawToImage
+		// and DrawOverImage stay on the calling goroutine, since starting
+		// workers costs more than writing a small icon. Zero selects 256*256.
+		ParallelMin int
+		layers      []linkLayer
+		spanPool    []spanList
 	}
 
 	// ImgSpanner is a Spanner that draws Spans onto *xgraphics.Image
 	// or *image.RGBA image types
-	// It uses either a color function as a the color source, or a fgColor
-	// if colFunc is nil.
+	// It uses either a Paint as the color source, or a fgColor
+	// if paint is nil. Color functions are wrapped as a ColorFuncPaint.
 	ImgSpanner struct {
 		baseSpanner
 		pix    []uint8
 		stride int
+		// offset is added to pixel indices, so that images and layer
+		// buffers that do not start at (0, 0) are drawn with image coordinates.
+		offset int
 
 		// xgraphics.Images swap r and b pixel values
 		// compared to saved rgb value.
 		xpixel    bool
-		colorFunc rasterx.ColorFunc
+		layers    []imgLayer
+		layerPool [][]uint8
 	}
 )
 
-//Clear clears the current spans
+//Clear clears the current spans. Only the rows that have spans are
+// reset, so clearing a large spanner after drawing a small icon is cheap.
 func (x *LinkListSpanner) Clear() {
-	x.lastY, x.lastP = 0, 0
-	x.spans = x.spans[0:0]
-	width := x.bounds.Dy()
-	for i := 0; i < width; i++ {
-		// The first cells are indexed according to the y values
-		// to create y separate linked lists corresponding to the
-		// image y length. Since index 0 is used by the first of these sentinel cells
-		// 0 can and is used for the end of list value by the spanner linked list.
-		x.spans = append(x.spans, spanCell{})
-	}
-}
-
-func (x *LinkListSpanner) spansToImage(img draw.Image) {
-	for y := 0; y < x.bounds.Dy(); y++ {
-		p := x.spans[y].next
-		for p != 0 {
-			spCell := x.spans[p]
+	x.spans.reset(x.bounds)
+}
+
+// visible returns the part of the spanner bounds that is drawn onto an image
+// with bounds dst when bounds.Min is placed at pt, and the translation d from
+// spanner to image coordinates.
+func (x *LinkListSpanner) visible(dst image.Rectangle, pt image.Point) (r image.Rectangle, d image.Point) {
+	d = pt.Sub(x.bounds.Min)
+	return x.bounds.Intersect(dst.Sub(d)), d
+}
+
+// clipCell returns the columns of the span cell c that lie within r.
+func clipCell(c spanCell, r image.Rectangle) (x0, x1 int) {
+	x0, x1 = c.x0, c.x1
+	if x0 < r.Min.X {
+		x0 = r.Min.X
+	}
+	if x1 > r.Max.X {
+		x1 = r.Max.X
+	}
+	return
+}
+
+// pixOrigin returns the index into the Pix of an image with the given stride,
+// bytes per pixel and bounds of the spanner pixel (0, 0) translated by d.
+func pixOrigin(stride, bpp int, rect image.Rectangle, d image.Point) int {
+	return (d.Y-rect.Min.Y)*stride + (d.X-rect.Min.X)*bpp
+}
+
+func (x *LinkListSpanner) spansToImage(img draw.Image, r image.Rectangle, d image.Point) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for spCell := range x.spans.row(y - x.bounds.Min.Y) {
 			clr := spCell.clr
-			x0, x1 := spCell.x0, spCell.x1
-			for x := x0; x < x1; x++ {
-				img.Set(y, x, clr)
+			x0, x1 := clipCell(spCell, r)
+			for cx := x0; cx < x1; cx++ {
+				img.Set(cx+d.X, y+d.Y, clr)
 			}
-			p = spCell.next
 		}
 	}
 }
 
-func (x *LinkListSpanner) spansToPix(pix []uint8, stride int, xpixel bool) {
-	for y := 0; y < x.bounds.Dy(); y++ {
-		yo := y * stride
-		p := x.spans[y].next
-		for p != 0 {
-			spCell := x.spans[p]
-			i0 := yo + spCell.x0*4
-			i1 := i0 + (spCell.x1-spCell.x0)*4
-			r, g, b, a := spCell.clr.R, spCell.clr.G, spCell.clr.B, spCell.clr.A
+func (x *LinkListSpanner) spansToPix(pix []uint8, stride, origin int, r image.Rectangle, xpixel bool) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		yo := y*stride + origin
+		if px, cover := x.spans.pixels(y - x.bounds.Min.Y); px != nil {
+			x.pixelsToPix(pix[yo:], px, cover, r, xpixel)
+			continue
+		}
+		for spCell := range x.spans.row(y - x.bounds.Min.Y) {
+			x0, x1 := clipCell(spCell, r)
+			if x0 >= x1 {
+				continue
+			}
+			clr := spCell.clr
 			if xpixel { // R and B are reversed in xgraphics.Image vs image.RGBA
-				r, b = b, r
+				clr.R, clr.B = clr.B, clr.R
 			}
-			for i := i0; i < i1; i += 4 {
-				pix[i+0] = r
-				pix[i+1] = g
-				pix[i+2] = b
-				pix[i+3] = a
+			fillPix(pix[yo+x0*4:yo+x1*4], clr)
+		}
+	}
+}
+
+// fillPix sets every pixel of pix to clr, copying the pixels already set
+// to fill the rest, which is faster than setting long runs byte by byte.
+func fillPix(pix []uint8, clr color.RGBA) {
+	if len(pix) < 4 {
+		return
+	}
+	pix[0], pix[1], pix[2], pix[3] = clr.R, clr.G, clr.B, clr.A
+	for n := 4; n < len(pix); n *= 2 {
+		copy(pix[n:], pix[:n])
+	}
+}
+
+// pixelsToPix writes the covered pixels of a dense row that lie within r to
+// the image row pix.
+func (x *LinkListSpanner) pixelsToPix(pix []uint8, px []color.RGBA, cover []uint64, r image.Rectangle, xpixel bool) {
+	for cx := r.Min.X; cx < r.Max.X; {
+		i := cx - x.bounds.Min.X
+		word := cover[i>>6] >> uint(i&63)
+		n := min(64-i&63, r.Max.X-cx)
+		for k := 0; word != 0 && k < n; k, word = k+1, word>>1 {
+			if word&1 != 0 {
+				c := px[i+k]
+				if xpixel {
+					c.R, c.B = c.B, c.R
+				}
+				p := pix[(cx+k)*4 : (cx+k)*4+4 : (cx+k)*4+4]
+				p[0], p[1], p[2], p[3] = c.R, c.G, c.B, c.A
 			}
-			p = spCell.next
 		}
+		cx += n
 	}
 }
 
-//DrawToImage draws the accumulated y spans onto the img
+func (x *LinkListSpanner) spansTo16(img *Packed16Image, r image.Rectangle, d image.Point) {
+	var biases [4]uint32
+	var vals [4]uint16
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		yo := img.PixOffset(d.X, y+d.Y)
+		ditherRow(x.Dither, y+d.Y, &biases)
+		for spCell := range x.spans.row(y - x.bounds.Min.Y) {
+			for k := range vals {
+				vals[k] = img.Format.pack(spCell.clr, biases[k])
+			}
+			x0, x1 := clipCell(spCell, r)
+			for cx := x0; cx < x1; cx++ {
+				store16(img.Pix, yo+cx*2, vals[(cx+d.X)&3], img.BigEndian)
+			}
+		}
+	}
+}
+
+//DrawToImage draws the accumulated y spans onto the img at the
+// same coordinates, clipped to the image bounds
 func (x *LinkListSpanner) DrawToImage(img image.Image) {
+	x.DrawToImageAt(img, x.bounds.Min)
+}
+
+// DrawToImageAt draws the accumulated y spans onto the img with the spanner
+// bounds.Min placed at pt, clipped to the image bounds. An accumulated icon
+// can be stamped at several positions by calling it with different points.
+// Rows are written by Workers goroutines for *image.RGBA, *xgraphics.Image,
+// *Packed16Image and *image.Paletted images once the drawn area reaches
+// ParallelMin pixels.
+func (x *LinkListSpanner) DrawToImageAt(img image.Image, pt image.Point) {
+	r, d := x.visible(img.Bounds(), pt)
 	switch img := img.(type) {
 	case *xgraphics.Image:
-		x.spansToPix(img.Pix, img.Stride, true)
+		origin := pixOrigin(img.Stride, 4, img.Rect, d)
+		x.forRows(r, func(band image.Rectangle) {
+			x.spansToPix(img.Pix, img.Stride, origin, band, true)
+		})
 	case *image.RGBA:
-		x.spansToPix(img.Pix, img.Stride, false)
+		origin := pixOrigin(img.Stride, 4, img.Rect, d)
+		x.forRows(r, func(band image.Rectangle) {
+			x.spansToPix(img.Pix, img.Stride, origin, band, false)
+		})
+	case *Packed16Image:
+		x.forRows(r, func(band image.Rectangle) {
+			x.spansTo16(img, band, d)
+		})
+	case *image.Paletted:
+		x.forRows(r, func(band image.Rectangle) {
+			x.spansToPaletted(img, band, d)
+		})
+	case *Bitmap:
+		x.spansToBitmap(img, r, d)
 	case draw.Image:
-		x.spansToImage(img)
+		x.spansToImage(img, r, d)
+	}
+}
+
+// DrawOverImage composites the accumulated y spans over the existing pixels
+// of img with the draw.Over operator, rather than replacing them like
+// DrawToImage, and leaves the pixels that no span covers unchanged. Since each
+// span holds the premultiplied color and coverage of everything drawn onto it,
+// this matches drawing directly onto img when bgColor is transparent and the
+// spans were drawn with Over. The spans do not keep their coverage, so a
+// bgColor that is not transparent is composited into every covered pixel,
+// and an opaque bgColor replaces the covered pixels of img as DrawToImage
+// does. Operators that remove the destination, such as Clear, Src or
+// DstOut, only apply to what was drawn onto the spanner.
+func (x *LinkListSpanner) DrawOverImage(img draw.Image) {
+	x.DrawOverImageAt(img, x.bounds.Min)
+}
+
+// DrawOverImageAt is like DrawOverImage, but places the spanner bounds.Min at pt.
+func (x *LinkListSpanner) DrawOverImageAt(img draw.Image, pt image.Point) {
+	r, d := x.visible(img.Bounds(), pt)
+	switch img := img.(type) {
+	case *xgraphics.Image:
+		origin := pixOrigin(img.Stride, 4, img.Rect, d)
+		x.forRows(r, func(band image.Rectangle) {
+			x.spansOverPix(img.Pix, img.Stride, origin, band, true)
+		})
+	case *image.RGBA:
+		origin := pixOrigin(img.Stride, 4, img.Rect, d)
+		x.forRows(r, func(band image.Rectangle) {
+			x.spansOverPix(img.Pix, img.Stride, origin, band, false)
+		})
+	default:
+		x.spansOverImage(img, r, d)
+	}
+}
+
+func (x *LinkListSpanner) spansOverPix(pix []uint8, stride, origin int, r image.Rectangle, xpixel bool) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		yo := y*stride + origin
+		for spCell := range x.spans.row(y - x.bounds.Min.Y) {
+			clr := spCell.clr
+			if clr.A == 0 {
+				continue
+			}
+			if xpixel { // R and B are reversed in xgraphics.Image vs image.RGBA
+				clr.R, clr.B = clr.B, clr.R
+			}
+			x0, x1 := clipCell(spCell, r)
+			i0 := yo + x0*4
+			i1 := i0 + (x1-x0)*4
+			for i := i0; i < i1; i += 4 {
+				c := clr
+				if clr.A != 0xFF {
+					c = overRGBA(clr, color.RGBA{pix[i+0], pix[i+1], pix[i+2], pix[i+3]}, m)
+				}
+				pix[i+0] = c.R
+				pix[i+1] = c.G
+				pix[i+2] = c.B
+				pix[i+3] = c.A
+			}
+		}
+	}
+}
+
+func (x *LinkListSpanner) spansOverImage(img draw.Image, r image.Rectangle, d image.Point) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for spCell := range x.spans.row(y - x.bounds.Min.Y) {
+			if spCell.clr.A == 0 {
+				continue
+			}
+			x0, x1 := clipCell(spCell, r)
+			for cx := x0; cx < x1; cx++ {
+				img.Set(cx+d.X, y+d.Y, overRGBA(spCell.clr, getColorRGBA(img.At(cx+d.X, y+d.Y)), m))
+			}
+		}
 	}
 }
 
 // SetBounds sets the spanner boundaries
 func (x *LinkListSpanner) SetBounds(bounds image.Rectangle) {
 	x.bounds = bounds
+	x.clip = bounds
 	x.Clear()
 }
 
+// Bounds returns the spanner boundaries
+func (x *LinkListSpanner) Bounds() image.Rectangle {
+	return x.bounds
+}
+
+// SetOpacity sets a multiplier, from 0 to 1, that scales the coverage of
+// every span before it is composited. An opacity of 1 has no cost.
+func (x *baseSpanner) SetOpacity(opacity float64) {
+	x.opacity = opacity16(opacity)
+	x.useOpacity = x.opacity != m
+}
+
+// opacity16 converts an opacity from 0 to 1 to a coverage from 0 to m.
+func opacity16(opacity float64) uint32 {
+	if opacity < 0 {
+		opacity = 0
+	} else if opacity > 1 {
+		opacity = 1
+	}
+	return uint32(opacity*m + 0.5)
+}
+
+// withOpacity returns f, wrapped to scale the coverage by the opacity if it is less than 1.
+func (x *baseSpanner) withOpacity(f SpanFunc) SpanFunc {
+	if !x.useOpacity {
+		return f
+	}
+	o := x.opacity
+	return func(yi, xi0, xi1 int, ma uint32) {
+		f(yi, xi0, xi1, (ma*o+m/2)/m)
+	}
+}
+
+// withClip returns f, wrapped to clip the spans to x.clip. While the clip is
+// the whole of bounds that start at (0, 0), f is returned bare, since the
+// scanner of a spanner of that size only makes spans within the bounds.
+func (x *baseSpanner) withClip(f SpanFunc) SpanFunc {
+	r := x.clip
+	if r == x.bounds && r.Min == (image.Point{}) {
+		return f
+	}
+	return func(yi, xi0, xi1 int, ma uint32) {
+		if yi < r.Min.Y || yi >= r.Max.Y {
+			return
+		}
+		if xi0 < r.Min.X {
+			xi0 = r.Min.X
+		}
+		if xi1 > r.Max.X {
+			xi1 = r.Max.X
+		}
+		if xi0 < xi1 {
+			f(yi, xi0, xi1, ma)
+		}
+	}
+}
+
+// fastOp reports whether spans can be drawn by the Over and Src fast paths
+// rather than the general compositing functions.
+func (x *baseSpanner) fastOp() bool {
+	op := x.compositeOp()
+	return (op == SrcOver || op == Src) && x.Blend == BlendNormal && !x.LinearLight
+}
+
 func getColorRGBA(c interface{}) (rgba color.RGBA) {
 	switch c := c.(type) {
 	case color.Color:
@@ -147,11 +421,23 @@ func (x *LinkListSpanner) blendColor(under color.RGBA, ma uint32) color.RGBA {
 	if ma == 0 {
 		return under
 	}
-	rma := uint32(x.fgColor.R) * ma
-	gma := uint32(x.fgColor.G) * ma
-	bma := uint32(x.fgColor.B) * ma
-	ama := uint32(x.fgColor.A) * ma
-	if x.Op != draw.Over || under.A == 0 || ama == m*0xFF {
+	if !x.fastOp() {
+		return x.compositeRGBA(x.fgColor, under, ma)
+	}
+	if x.compositeOp() != SrcOver {
+		return overRGBA(x.fgColor, color.RGBA{}, ma)
+	}
+	return overRGBA(x.fgColor, under, ma)
+}
+
+// overRGBA composites c over under with coverage ma, using the 8 bit arithmetic
+// of the draw.Over fast path.
+func overRGBA(c, under color.RGBA, ma uint32) color.RGBA {
+	rma := uint32(c.R) * ma
+	gma := uint32(c.G) * ma
+	bma := uint32(c.B) * ma
+	ama := uint32(c.A) * ma
+	if under.A == 0 || ama == m*0xFF {
 		return color.RGBA{
 			uint8(rma / q),
 			uint8(gma / q),
@@ -167,89 +453,166 @@ func (x *LinkListSpanner) blendColor(under color.RGBA, ma uint32) color.RGBA {
 	return cc
 }
 
-func (x *LinkListSpanner) addLink(x0, x1, next, pp int, underColor color.RGBA, alpha uint32) (p int) {
-	clr := x.blendColor(underColor, alpha)
-	if pp >= x.bounds.Dy() && x.spans[pp].x1 >= x0 && ((clr.A == 0 && x.spans[pp].clr.A == 0) || clr == x.spans[pp].clr) {
-		// Just extend the prev span; a new one is not required
-		x.spans[pp].x1 = x1
-		return pp
+// appendCell appends a cell of clr from x0 to x1 to cells, or extends the
+// last cell if it ends at x0 with the same color.
+func appendCell(cells []cell32, x0, x1 int, clr color.RGBA) []cell32 {
+	if n := len(cells); n > 0 && int(cells[n-1].x1) == x0 && cells[n-1].clr == clr {
+		cells[n-1].x1 = int32(x1)
+		return cells
 	}
-	x.spans = append(x.spans, spanCell{x0: x0, x1: x1, next: next, clr: clr})
-	p = len(x.spans) - 1
-	x.spans[pp].next = p
-	return
+	return append(cells, cell32{x0: int32(x0), x1: int32(x1), clr: clr})
 }
 
 // GetSpanFunc returns the function that consumes a span described by the parameters.
 func (x *LinkListSpanner) GetSpanFunc() SpanFunc {
-	x.lastY = -1 // x within a y list may no longer be ordered, so this ensures a reset.
-	return x.SpanOver
+	if x.paint != nil {
+		return x.withClip(x.withOpacity(x.SpanPaint))
+	}
+	return x.withClip(x.withOpacity(x.SpanOver))
 }
 
-// SpanOver adds the span into an array of linked lists of spans using the fgColor and Porter-Duff composition
-// ma is the accumulated alpha coverage. This function also assumes usage sorted x inputs for each y and so if
-// inputs for x in y are not monotonically increasing, then lastY should be set to -1.
+// SpanPaint adds the span using the paint as the color source. The span
+// is divided into runs of pixels of the same color, and each run is added
+// with SpanOver, so areas of constant color still take a single span cell.
+func (x *LinkListSpanner) SpanPaint(yi, xi0, xi1 int, ma uint32) {
+	run := xi0
+	var clr color.RGBA
+	for i, c := range x.paintSpan(yi, xi0, xi1) {
+		c8 := color.RGBA{uint8(c.R >> 8), uint8(c.G >> 8), uint8(c.B >> 8), uint8(c.A >> 8)}
+		if i == 0 {
+			clr = c8
+		} else if c8 != clr {
+			x.fgColor = clr
+			x.SpanOver(yi, run, xi0+i, ma)
+			run, clr = xi0+i, c8
+		}
+	}
+	x.fgColor = clr
+	x.SpanOver(yi, run, xi1, ma)
+}
+
+// SpanOver adds the span into the cells of its row using the fgColor and Porter-Duff composition.
+// ma is the accumulated alpha coverage. The cells under the span are replaced by cells of their
+// colors composited with the fgColor, and the gaps between them by cells of the bgColor composited
+// with the fgColor. Cells that end up next to a cell of the same color are merged with it.
 func (x *LinkListSpanner) SpanOver(yi, xi0, xi1 int, ma uint32) {
-	if yi != x.lastY { // If the y place has changed, start at the list beginning
-		x.lastP = yi
-		x.lastY = yi
-	}
-	// since spans are sorted, we can start from x.lastP
-	pp := x.lastP
-	p := x.spans[pp].next
-	for p != 0 && xi0 < xi1 {
-		sp := x.spans[p]
-		if sp.x1 <= xi0 { //sp is before new span
-			pp = p
-			p = sp.next
-			continue
+	if xi0 >= xi1 {
+		return
+	}
+	s := &x.spans
+	row := yi - x.bounds.Min.Y
+	if pix, cover := s.pixels(row); pix != nil {
+		x.spanPixels(pix, cover, xi0-x.bounds.Min.X, xi1-x.bounds.Min.X, ma)
+		return
+	}
+	chunks := s.rows[row]
+	c0, k0 := s.find(row, xi0)
+	c1, k1 := c0, k0
+	buf := s.buf[:0]
+	cur := xi0 // the start of the part of the span not yet added
+cells:
+	for ; c1 < len(chunks); c1, k1 = c1+1, 0 {
+		for cells := s.block(chunks[c1]); k1 < len(cells); k1++ {
+			sp := cells[k1]
+			x0, x1 := int(sp.x0), int(sp.x1)
+			if x0 >= xi1 {
+				break cells
+			}
+			if x0 > cur { // gap before sp
+				buf = appendCell(buf, cur, x0, x.blendColor(x.bgColor, ma))
+			} else if x0 < cur { // part of sp before the span
+				buf = appendCell(buf, x0, cur, sp.clr)
+				x0 = cur
+			}
+			if x1 > xi1 { // sp goes beyond the span
+				buf = appendCell(buf, x0, xi1, x.blendColor(sp.clr, ma))
+				buf = appendCell(buf, xi1, x1, sp.clr)
+			} else {
+				buf = appendCell(buf, x0, x1, x.blendColor(sp.clr, ma))
+			}
+			cur = x1
 		}
-		if sp.x0 >= xi1 { //new span is before sp
-			x.lastP = x.addLink(xi0, xi1, p, pp, x.bgColor, ma)
-			return
+	}
+	if cur < xi1 {
+		buf = appendCell(buf, cur, xi1, x.blendColor(x.bgColor, ma))
+	}
+	// merge with the cells on either side
+	if k0 > 0 || c0 > 0 {
+		pc, pk := c0, k0-1
+		if k0 == 0 {
+			pc, pk = c0-1, int(chunks[c0-1].n)-1
+		}
+		if prev := s.block(chunks[pc])[pk]; prev.x1 == buf[0].x0 && prev.clr == buf[0].clr {
+			buf[0].x0 = prev.x0
+			c0, k0 = pc, pk
 		}
-		// left span
-		if xi0 < sp.x0 {
-			pp = x.addLink(xi0, sp.x0, p, pp, x.bgColor, ma)
-			xi0 = sp.x0
-		} else if xi0 > sp.x0 {
-			pp = x.addLink(sp.x0, xi0, p, pp, sp.clr, 0)
+	}
+	if c1 < len(chunks) && k1 < int(chunks[c1].n) {
+		last := &buf[len(buf)-1]
+		if next := s.block(chunks[c1])[k1]; next.x0 == last.x1 && next.clr == last.clr {
+			last.x1 = next.x1
+			k1++
 		}
+	}
+	s.buf = buf
+	s.replace(row, c0, k0, c1, k1, buf)
+}
 
-		clr := x.blendColor(sp.clr, ma)
-		sameClrs := pp >= x.bounds.Dy() && ((clr.A == 0 && x.spans[pp].clr.A == 0) || clr == x.spans[pp].clr)
-		if xi1 < sp.x1 { // span does not go beyond sp
-			// merge with left span
-			if x.spans[pp].x1 >= xi0 && sameClrs {
-				x.spans[pp].x1 = xi1
-				x.spans[pp].next = sp.next
-				// Suffices not to advance lastP ?!? Testing says NO!
-				x.lastP = yi // We need to go back, so let's just go to start of the list next time
-				p = pp
-			} else {
-				// middle span; replaces sp
-				x.spans[p] = spanCell{x0: xi0, x1: xi1, next: sp.next, clr: clr}
-				x.lastP = pp
+// spanPixels adds the span from pixel i0 to pixel i1 of a dense row, with the
+// same result for each pixel as for a cell of its own.
+func (x *LinkListSpanner) spanPixels(pix []color.RGBA, cover []uint64, i0, i1 int, ma uint32) {
+	row := pix[i0:i1]
+	if w := i0 >> 6; w == (i1-1)>>6 {
+		// a span within one cover word, as most are, is checked at once
+		if mask := uint64(1<<uint(i1-i0)-1) << uint(i0&63); cover[w]&mask != mask {
+			for i := range row {
+				if j := i0 + i; cover[w]&(1<<uint(j&63)) == 0 {
+					row[i] = x.bgColor
+				}
 			}
-			x.addLink(xi1, sp.x1, sp.next, p, sp.clr, 0)
-			return
+			cover[w] |= mask
 		}
-		if x.spans[pp].x1 >= xi0 && sameClrs { // Extend and merge with previous
-			x.spans[pp].x1 = sp.x1
-			x.spans[pp].next = sp.next
-			p = sp.next // clip out the current span from the list
-			xi0 = sp.x1 // set remaining to start for next loop
-			continue
+	} else if !covered(cover, i0, i1) {
+		for i := range row {
+			if j := i0 + i; cover[j>>6]&(1<<uint(j&63)) == 0 {
+				row[i] = x.bgColor
+			}
+		}
+		setCover(cover, i0, i1)
+	}
+	if ma == 0 {
+		return
+	}
+	if !x.fastOp() {
+		for i, under := range row {
+			row[i] = x.blendColor(under, ma)
 		}
-		// Set current span to start of new span and combined color
-		x.spans[p] = spanCell{x0: xi0, x1: sp.x1, next: sp.next, clr: clr}
-		xi0 = sp.x1 // any remaining span starts at sp.x1
-		pp = p
-		p = sp.next
+		return
 	}
-	x.lastP = pp
-	if xi0 < xi1 { // add any remaining span to the end of the chain
-		x.addLink(xi0, xi1, 0, pp, x.bgColor, ma)
+	// overRGBA, with the terms of the color computed once
+	c := x.fgColor
+	rma := uint32(c.R) * ma
+	gma := uint32(c.G) * ma
+	bma := uint32(c.B) * ma
+	ama := uint32(c.A) * ma
+	top := color.RGBA{uint8(rma / q), uint8(gma / q), uint8(bma / q), uint8(ama / q)}
+	if ama == m*0xFF || x.compositeOp() != SrcOver {
+		for i := range row {
+			row[i] = top
+		}
+		return
+	}
+	a := m - (ama / (m >> 8))
+	for i, under := range row {
+		if under.A == 0 {
+			row[i] = top
+			continue
+		}
+		row[i] = color.RGBA{
+			uint8((uint32(under.R)*a + rma) / q),
+			uint8((uint32(under.G)*a + gma) / q),
+			uint8((uint32(under.B)*a + bma) / q),
+			uint8((uint32(under.A)*a + ama) / q)}
 	}
 }
 
@@ -258,9 +621,18 @@ func (x *LinkListSpanner) SetBgColor(c interface{}) {
 	x.bgColor = getColorRGBA(c)
 }
 
-// SetColor sets the color of x if it is a color.Color and ignores a rasterx.ColorFunction
+// SetColor sets the color of x to a color.Color, a rasterx.ColorFunction
+// or a Paint.
 func (x *LinkListSpanner) SetColor(c interface{}) {
-	x.fgColor = getColorRGBA(c)
+	switch c := c.(type) {
+	case Paint:
+		x.paint = preparePaint(c)
+	case color.Color:
+		x.paint = nil
+		x.fgColor = getColorRGBA(c)
+	case rasterx.ColorFunc:
+		x.paint = ColorFuncPaint(c)
+	}
 }
 
 // NewImgSpanner returns an ImgSpanner set to draw to the img.
@@ -285,13 +657,19 @@ func (x *ImgSpanner) SetImage(img interface{}) {
 		x.xpixel = false
 		x.bounds = img.Bounds()
 	}
+	// spans are in image coordinates, so Pix index 0 is bounds.Min
+	x.offset = pixOrigin(x.stride, 4, x.bounds, image.Point{})
+	x.clip = x.bounds
 }
 
-// SetColor sets the color of x to either a color.Color or a rasterx.ColorFunction
+// SetColor sets the color of x to a color.Color, a rasterx.ColorFunction
+// or a Paint.
 func (x *ImgSpanner) SetColor(c interface{}) {
 	switch c := c.(type) {
+	case Paint:
+		x.paint = preparePaint(c)
 	case color.Color:
-		x.colorFunc = nil
+		x.paint = nil
 		r, g, b, a := c.RGBA()
 		if x.xpixel == true { // apparently r and b values swap in xgraphics.Image
 			r, b = b, r
@@ -302,52 +680,52 @@ func (x *ImgSpanner) SetColor(c interface{}) {
 			B: uint8(b >> 8),
 			A: uint8(a >> 8)}
 	case rasterx.ColorFunc:
-		x.colorFunc = c
+		x.paint = ColorFuncPaint(c)
 	}
 }
 
 // GetSpanFunc returns the function that consumes a span described by the parameters.
-// The next four func declarations are all slightly different
+// The next six func declarations are all slightly different
 // but in order to reduce code redundancy, this method is used
 // to dispatch the function in the draw method.
 func (x *ImgSpanner) GetSpanFunc() SpanFunc {
+	return x.withClip(x.withOpacity(x.spanFunc()))
+}
+
+// spanFunc selects the span function for the color source and compositing settings.
+func (x *ImgSpanner) spanFunc() SpanFunc {
 	var (
-		useColorFunc = x.colorFunc != nil
-		drawOver     = x.Op == draw.Over
+		usePaint = x.paint != nil
+		fast     = x.fastOp()
+		drawOver = fast && x.compositeOp() == SrcOver
+		drawSrc  = fast && x.compositeOp() == Src
 	)
 	switch {
-	case useColorFunc && drawOver:
-		return x.SpanColorFunc
-	case useColorFunc && !drawOver:
-		return x.SpanColorFuncR
-	case !useColorFunc && !drawOver:
+	case usePaint && drawOver:
+		return x.SpanPaint
+	case usePaint && drawSrc:
+		return x.SpanPaintR
+	case usePaint:
+		return x.SpanPaintOp
+	case drawOver:
+		return x.SpanFgColor
+	case drawSrc:
 		return x.SpanFgColorR
 	default:
-		return x.SpanFgColor
+		return x.SpanFgColorOp
 	}
 }
 
-//SpanColorFuncR draw the span using a colorFunc and replaces the previous values.
+//SpanColorFuncR draws the span using the paint and replaces the previous values.
+//
+// Deprecated: color functions are wrapped as a ColorFuncPaint by SetColor; use SpanPaintR.
 func (x *ImgSpanner) SpanColorFuncR(yi, xi0, xi1 int, ma uint32) {
-	i0 := (yi)*x.stride + (xi0)*4
-	i1 := i0 + (xi1-xi0)*4
-	cx := xi0
-	for i := i0; i < i1; i += 4 {
-		rcr, rcg, rcb, rca := x.colorFunc(cx, yi).RGBA()
-		if x.xpixel == true {
-			rcr, rcb = rcb, rcr
-		}
-		cx++
-		x.pix[i+0] = uint8(rcr * ma / mp)
-		x.pix[i+1] = uint8(rcg * ma / mp)
-		x.pix[i+2] = uint8(rcb * ma / mp)
-		x.pix[i+3] = uint8(rca * ma / mp)
-	}
+	x.SpanPaintR(yi, xi0, xi1, ma)
 }
 
 //SpanFgColorR draws the span with the fore ground color and replaces the previous values.
 func (x *ImgSpanner) SpanFgColorR(yi, xi0, xi1 int, ma uint32) {
-	i0 := (yi)*x.stride + (xi0)*4
+	i0 := (yi)*x.stride + (xi0)*4 + x.offset
 	i1 := i0 + (xi1-xi0)*4
 	cr, cg, cb, ca := x.fgColor.RGBA()
 	rma := uint8(cr * ma / mp)
@@ -362,34 +740,16 @@ func (x *ImgSpanner) SpanFgColorR(yi, xi0, xi1 int, ma uint32) {
 	}
 }
 
-//SpanColorFunc draws the span using a colorFunc and the  Porter-Duff composition operator.
+//SpanColorFunc draws the span using the paint and the Porter-Duff composition operator.
+//
+// Deprecated: color functions are wrapped as a ColorFuncPaint by SetColor; use SpanPaint.
 func (x *ImgSpanner) SpanColorFunc(yi, xi0, xi1 int, ma uint32) {
-	i0 := (yi)*x.stride + (xi0)*4
-	i1 := i0 + (xi1-xi0)*4
-	cx := xi0
-
-	for i := i0; i < i1; i += 4 {
-		// uses the Porter-Duff composition operator.
-		rcr, rcg, rcb, rca := x.colorFunc(cx, yi).RGBA()
-		if x.xpixel == true {
-			rcr, rcb = rcb, rcr
-		}
-		cx++
-		a := (m - (rca * ma / m)) * pa
-		dr := uint32(x.pix[i+0])
-		dg := uint32(x.pix[i+1])
-		db := uint32(x.pix[i+2])
-		da := uint32(x.pix[i+3])
-		x.pix[i+0] = uint8((dr*a + rcr*ma) / mp)
-		x.pix[i+1] = uint8((dg*a + rcg*ma) / mp)
-		x.pix[i+2] = uint8((db*a + rcb*ma) / mp)
-		x.pix[i+3] = uint8((da*a + rca*ma) / mp)
-	}
+	x.SpanPaint(yi, xi0, xi1, ma)
 }
 
 //SpanFgColor draw the span using the fore ground color and the Porter-Duff composition operator.
 func (x *ImgSpanner) SpanFgColor(yi, xi0, xi1 int, ma uint32) {
-	i0 := (yi)*x.stride + (xi0)*4
+	i0 := (yi)*x.stride + (xi0)*4 + x.offset
 	i1 := i0 + (xi1-xi0)*4
 	// uses the Porter-Duff composition operator.
 	cr, cg, cb, ca := x.fgColor.RGBA()
@@ -418,3 +778,59 @@ func (x *ImgSpanner) SpanFgColor(yi, xi0, xi1 int, ma uint32) {
 		x.pix[i+3] = uint8((uint32(x.pix[i+3])*a + ama) / mp)
 	}
 }
+
+//SpanFgColorOp draws the span using the fore ground color and the general compositing settings of x.
+func (x *ImgSpanner) SpanFgColorOp(yi, xi0, xi1 int, ma uint32) {
+	i0 := (yi)*x.stride + (xi0)*4 + x.offset
+	i1 := i0 + (xi1-xi0)*4
+	cr, cg, cb, ca := x.fgColor.RGBA()
+	for i := i0; i < i1; i += 4 {
+		x.compositePix(x.pix, i, cr, cg, cb, ca, ma, x.xpixel)
+	}
+}
+
+//SpanPaintR draws the span using the paint and replaces the previous values.
+func (x *ImgSpanner) SpanPaintR(yi, xi0, xi1 int, ma uint32) {
+	i := (yi)*x.stride + (xi0)*4 + x.offset
+	for _, c := range x.paintSpan(yi, xi0, xi1) {
+		rcr, rcg, rcb, rca := uint32(c.R), uint32(c.G), uint32(c.B), uint32(c.A)
+		if x.xpixel == true {
+			rcr, rcb = rcb, rcr
+		}
+		x.pix[i+0] = uint8(rcr * ma / mp)
+		x.pix[i+1] = uint8(rcg * ma / mp)
+		x.pix[i+2] = uint8(rcb * ma / mp)
+		x.pix[i+3] = uint8(rca * ma / mp)
+		i += 4
+	}
+}
+
+//SpanPaint draws the span using the paint and the Porter-Duff composition operator.
+func (x *ImgSpanner) SpanPaint(yi, xi0, xi1 int, ma uint32) {
+	i := (yi)*x.stride + (xi0)*4 + x.offset
+	for _, c := range x.paintSpan(yi, xi0, xi1) {
+		rcr, rcg, rcb, rca := uint32(c.R), uint32(c.G), uint32(c.B), uint32(c.A)
+		if x.xpixel == true {
+			rcr, rcb = rcb, rcr
+		}
+		a := (m - (rca * ma / m)) * pa
+		x.pix[i+0] = uint8((uint32(x.pix[i+0])*a + rcr*ma) / mp)
+		x.pix[i+1] = uint8((uint32(x.pix[i+1])*a + rcg*ma) / mp)
+		x.pix[i+2] = uint8((uint32(x.pix[i+2])*a + rcb*ma) / mp)
+		x.pix[i+3] = uint8((uint32(x.pix[i+3])*a + rca*ma) / mp)
+		i += 4
+	}
+}
+
+//SpanPaintOp draws the span using the paint and the general compositing settings of x.
+func (x *ImgSpanner) SpanPaintOp(yi, xi0, xi1 int, ma uint32) {
+	i := (yi)*x.stride + (xi0)*4 + x.offset
+	for _, c := range x.paintSpan(yi, xi0, xi1) {
+		rcr, rcg, rcb, rca := uint32(c.R), uint32(c.G), uint32(c.B), uint32(c.A)
+		if x.xpixel == true {
+			rcr, rcb = rcb, rcr
+		}
+		x.compositePix(x.pix, i, rcr, rcg, rcb, rca, ma, x.xpixel)
+		i += 4
+	}
+}
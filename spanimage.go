@@ -0,0 +1,107 @@
+package scanx
+
+import (
+	"image"
+	"image/color"
+)
+
+// SpanImage is an image.Image that reads its pixels directly from the spans
+// of a LinkListSpanner, so a drawing can be passed to an encoder or to
+// draw.Draw without first being drawn to an image buffer. Its pixels are
+// those that DrawToImage writes onto a transparent image, so pixels that no
+// span covers are transparent. A cursor in the current row makes reading
+// the pixels from left to right take constant time per pixel, and other
+// pixels are found by a binary search of the cells of their row. The spanner
+// must not be drawn onto or cleared while the image is read, and a
+// SpanImage must not be read by several goroutines at once.
+type SpanImage struct {
+	x    *LinkListSpanner
+	row  int // the row of the cursor, or -1
+	from int // the column of the last pixel read
+	c, k int // the chunk and the index in the chunk of the cell at the cursor
+}
+
+// Image returns a SpanImage of the spans of x. Like DrawToImage, only the
+// spans of the top layer are seen while layers are pushed.
+func (x *LinkListSpanner) Image() *SpanImage {
+	return &SpanImage{x: x, row: -1}
+}
+
+// ColorModel returns color.RGBAModel.
+func (m *SpanImage) ColorModel() color.Model {
+	return color.RGBAModel
+}
+
+// Bounds returns the bounds of the spanner.
+func (m *SpanImage) Bounds() image.Rectangle {
+	return m.x.bounds
+}
+
+// At returns the color of the pixel at (x, y).
+func (m *SpanImage) At(x, y int) color.Color {
+	return m.RGBAAt(x, y)
+}
+
+// RGBA64At returns the color of the pixel at (x, y).
+func (m *SpanImage) RGBA64At(x, y int) color.RGBA64 {
+	c := m.RGBAAt(x, y)
+	r, g, b, a := c.RGBA()
+	return color.RGBA64{uint16(r), uint16(g), uint16(b), uint16(a)}
+}
+
+// RGBAAt returns the color of the pixel at (x, y). The cursor moves forward
+// from the last pixel read when it is in the same row and not to the right
+// of (x, y), and is otherwise found again.
+func (m *SpanImage) RGBAAt(x, y int) color.RGBA {
+	s := m.x
+	if !(image.Point{x, y}.In(s.bounds)) || len(s.spans.rows) < s.bounds.Dy() {
+		return color.RGBA{}
+	}
+	row := y - s.bounds.Min.Y
+	if pix, cover := s.spans.pixels(row); pix != nil {
+		if i := x - s.bounds.Min.X; cover[i>>6]&(1<<uint(i&63)) != 0 {
+			return pix[i]
+		}
+		return color.RGBA{}
+	}
+	if row != m.row || x < m.from {
+		m.row = row
+		m.c, m.k = s.spans.find(row, x)
+	}
+	m.from = x
+	chunks := s.spans.rows[row]
+	for ; m.c < len(chunks); m.c, m.k = m.c+1, 0 {
+		cells := s.spans.block(chunks[m.c])
+		for ; m.k < len(cells); m.k++ {
+			if c := cells[m.k]; int(c.x1) > x {
+				if int(c.x0) <= x {
+					return c.clr
+				}
+				return color.RGBA{}
+			}
+		}
+	}
+	return color.RGBA{}
+}
+
+// Opaque reports whether every pixel of the image is covered by an opaque
+// span.
+func (m *SpanImage) Opaque() bool {
+	s := m.x
+	if s.bounds.Empty() {
+		return true
+	}
+	for y := s.bounds.Min.Y; y < s.bounds.Max.Y; y++ {
+		end := s.bounds.Min.X
+		for sp := range s.Spans(y) {
+			if sp.X0 != end || sp.Color.A != 0xFF {
+				return false
+			}
+			end = sp.X1
+		}
+		if end != s.bounds.Max.X {
+			return false
+		}
+	}
+	return true
+}
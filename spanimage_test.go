@@ -0,0 +1,66 @@
+package scanx_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"testing"
+
+	"github.com/srwiley/scanx"
+)
+
+func TestSpanImage(t *testing.T) {
+	width, height := 200, 175
+	lspanner := RenderLinkList(t, "testdata/svg/landscapeIcons/mountains.svg", width, height, nil)
+	want := image.NewRGBA(image.Rect(0, 0, width, height))
+	lspanner.DrawToImage(want)
+	m := lspanner.Image()
+
+	img := image.NewRGBA(want.Rect)
+	draw.Draw(img, img.Rect, m, image.Point{}, draw.Src)
+	if d := MaxPixDiff(img, want); d != 0 {
+		t.Errorf("drawing the SpanImage differs from DrawToImage by %d", d)
+	}
+
+	// pixels read in any order
+	for y := height - 1; y >= 0; y -= 7 {
+		for x := width - 1; x >= 0; x -= 3 {
+			if got := m.RGBAAt(x, y); got != want.RGBAAt(x, y) {
+				t.Fatalf("pixel (%d, %d) is %v, want %v", x, y, got, want.RGBAAt(x, y))
+			}
+		}
+	}
+	if got := m.At(-1, 5); got != (color.RGBA{}) {
+		t.Errorf("pixel outside of the bounds is %v", got)
+	}
+
+	// png stores unpremultiplied colors, so compare with the encoding of
+	// the drawn image
+	var buf, wantBuf bytes.Buffer
+	if err := png.Encode(&buf, m); err != nil {
+		t.Fatal("cannot encode SpanImage:", err)
+	}
+	png.Encode(&wantBuf, want)
+	if !bytes.Equal(buf.Bytes(), wantBuf.Bytes()) {
+		t.Error("encoded SpanImage differs from encoded DrawToImage")
+	}
+
+	// bounds away from the origin, and opacity
+	small := &scanx.LinkListSpanner{}
+	small.SetBounds(image.Rect(-4, 10, 6, 12))
+	fillRect(small, color.RGBA{0xFF, 0, 0, 0xFF}, image.Rect(-4, 10, 6, 12))
+	if !small.Image().Opaque() {
+		t.Error("fully covered SpanImage is not opaque")
+	}
+	fillRect(small, color.RGBA{0, 0, 0x40, 0x80}, image.Rect(2, 11, 3, 12))
+	if !small.Image().Opaque() {
+		t.Error("SpanImage blended over opaque spans is not opaque")
+	}
+	small.SetBounds(image.Rect(-4, 10, 7, 12))
+	fillRect(small, color.RGBA{0xFF, 0, 0, 0xFF}, image.Rect(-4, 10, 6, 12))
+	if small.Image().Opaque() {
+		t.Error("SpanImage with an uncovered column is opaque")
+	}
+}
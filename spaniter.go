@@ -0,0 +1,73 @@
+package scanx
+
+import (
+	"image/color"
+	"iter"
+)
+
+// A Span is a run of pixels of row Y accumulated by a LinkListSpanner, all of
+// the same premultiplied Color. X0 is an inclusive bound and X1 is exclusive,
+// the same as for slices.
+type Span struct {
+	Y, X0, X1 int
+	Color     color.RGBA
+}
+
+// Spans returns an iterator over the spans of row y, from left to right, in
+// the coordinates of the spanner bounds. Pixels that no span covers are left
+// out, while covered pixels are reported even when transparent, since
+// DrawToImage writes them. Rows outside of the bounds have no spans. The
+// spanner must not be drawn onto or cleared during the iteration, and like
+// DrawToImage, only the spans of the top layer are seen while layers are
+// pushed.
+func (x *LinkListSpanner) Spans(y int) iter.Seq[Span] {
+	return func(yield func(Span) bool) {
+		x.yieldRow(y, yield)
+	}
+}
+
+// AllSpans returns an iterator over the spans of every row of the bounds,
+// from top to bottom and left to right, as for Spans.
+func (x *LinkListSpanner) AllSpans() iter.Seq[Span] {
+	return func(yield func(Span) bool) {
+		for y := x.bounds.Min.Y; y < x.bounds.Max.Y; y++ {
+			if !x.yieldRow(y, yield) {
+				return
+			}
+		}
+	}
+}
+
+// yieldRow passes the spans of row y to yield, and reports whether yield
+// accepted all of them.
+func (x *LinkListSpanner) yieldRow(y int, yield func(Span) bool) bool {
+	if y < x.bounds.Min.Y || y >= x.bounds.Max.Y || len(x.spans.rows) < x.bounds.Dy() {
+		return true
+	}
+	for c := range x.spans.row(y - x.bounds.Min.Y) {
+		if !yield(Span{Y: y, X0: c.x0, X1: c.x1, Color: c.clr}) {
+			return false
+		}
+	}
+	return true
+}
+
+// Replay draws the spans of x with their colors onto target, from top to
+// bottom, by setting each color with target.SetColor and passing the spans
+// at full coverage to its span function. The spans are then composited by
+// the target with its own operator, mask or image, for example over an
+// existing image with an ImgSpanner. Covered pixels that are transparent are
+// replayed too, which leaves them unchanged when composited over. The target
+// must not be x.
+func (x *LinkListSpanner) Replay(target Spanner) {
+	var f SpanFunc
+	var clr color.RGBA
+	for s := range x.AllSpans() {
+		if f == nil || s.Color != clr {
+			clr = s.Color
+			target.SetColor(clr)
+			f = target.GetSpanFunc()
+		}
+		f(s.Y, s.X0, s.X1, 0xFFFF)
+	}
+}
@@ -0,0 +1,111 @@
+package scanx_test
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/srwiley/scanx"
+)
+
+func TestSpans(t *testing.T) {
+	bounds := image.Rect(10, 20, 40, 30)
+	lspanner := &scanx.LinkListSpanner{}
+	lspanner.SetBounds(bounds)
+	red, blue := color.RGBA{0xFF, 0, 0, 0xFF}, color.RGBA{0, 0, 0xFF, 0xFF}
+	fillRect(lspanner, red, image.Rect(12, 22, 20, 24))
+	fillRect(lspanner, blue, image.Rect(16, 23, 30, 26))
+
+	var got []scanx.Span
+	for s := range lspanner.Spans(23) {
+		got = append(got, s)
+	}
+	want := []scanx.Span{{Y: 23, X0: 12, X1: 16, Color: red}, {Y: 23, X0: 16, X1: 30, Color: blue}}
+	if len(got) != len(want) {
+		t.Fatalf("Spans(23) gave %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Spans(23) gave %v, want %v", got, want)
+		}
+	}
+	for _, y := range []int{0, 20, 26, 30} {
+		for s := range lspanner.Spans(y) {
+			t.Errorf("Spans(%d) gave %v for an empty row", y, s)
+		}
+	}
+
+	// painting every span reproduces DrawToImage
+	img := image.NewRGBA(bounds)
+	n := 0
+	for s := range lspanner.AllSpans() {
+		draw.Draw(img, image.Rect(s.X0, s.Y, s.X1, s.Y+1), image.NewUniform(s.Color), image.Point{}, draw.Src)
+		n++
+	}
+	if n != 5 {
+		t.Errorf("AllSpans gave %d spans, want 5", n)
+	}
+	img2 := image.NewRGBA(bounds)
+	lspanner.DrawToImage(img2)
+	if d := MaxPixDiff(img, img2); d != 0 {
+		t.Errorf("AllSpans differs from DrawToImage by %d", d)
+	}
+
+	// iteration stops when the loop breaks
+	n = 0
+	for range lspanner.AllSpans() {
+		n++
+		if n == 3 {
+			break
+		}
+	}
+	if n != 3 {
+		t.Errorf("AllSpans continued after break")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	width, height := 200, 175
+	file := "testdata/svg/landscapeIcons/mountains.svg"
+	lspanner := RenderLinkList(t, file, width, height, nil)
+	bounds := image.Rect(0, 0, width, height)
+
+	// replayed onto a transparent image, the spans draw as DrawToImage does
+	img1 := image.NewRGBA(bounds)
+	lspanner.DrawToImage(img1)
+	img2 := image.NewRGBA(bounds)
+	lspanner.Replay(scanx.NewImgSpanner(img2))
+	if d := MaxPixDiff(img1, img2); d != 0 {
+		t.Errorf("Replay onto a transparent image differs from DrawToImage by %d", d)
+	}
+
+	// and over an existing image as DrawOverImage does
+	img1, img2 = backdrop(width, height), backdrop(width, height)
+	lspanner.DrawOverImage(img1)
+	lspanner.Replay(scanx.NewImgSpanner(img2))
+	if d := MaxPixDiff(img1, img2); d > 1 {
+		t.Errorf("Replay over an image differs from DrawOverImage by %d", d)
+	}
+
+	// into another LinkListSpanner, which then holds the same spans
+	copied := &scanx.LinkListSpanner{}
+	copied.SetBounds(bounds)
+	lspanner.Replay(copied)
+	img1, img2 = image.NewRGBA(bounds), image.NewRGBA(bounds)
+	lspanner.DrawToImage(img1)
+	copied.DrawToImage(img2)
+	if d := MaxPixDiff(img1, img2); d != 0 {
+		t.Errorf("replayed LinkListSpanner differs by %d", d)
+	}
+
+	// through a mask, which leaves the masked out half transparent
+	mask := image.NewAlpha(image.Rect(0, 0, width/2, height))
+	draw.Draw(mask, mask.Rect, image.Opaque, image.Point{}, draw.Src)
+	img2 = image.NewRGBA(bounds)
+	lspanner.Replay(scanx.NewMaskSpanner(scanx.NewImgSpanner(img2), mask, scanx.AlphaMask))
+	draw.Draw(img1, image.Rect(width/2, 0, width, height), image.Transparent, image.Point{}, draw.Src)
+	if d := MaxPixDiff(img1, img2); d != 0 {
+		t.Errorf("replay through a mask differs by %d", d)
+	}
+}
@@ -0,0 +1,312 @@
+package scanx
+
+import (
+	"image"
+	"image/color"
+	"iter"
+	"slices"
+)
+
+// chunkCells is the number of cells a chunk can hold.
+const chunkCells = 32
+
+type (
+	// cell32 is the stored form of a spanCell, which takes 12 bytes instead
+	// of the 24 bytes of a spanCell on 64 bit platforms.
+	cell32 struct {
+		x0, x1 int32
+		clr    color.RGBA
+	}
+
+	// chunk is a run of from 1 to chunkCells cells of a row, kept in
+	// block b of the cell arena. x1 is the end of its last cell.
+	chunk struct {
+		b, n, x1 int32
+	}
+
+	// spanList holds the span cells of a LinkListSpanner. The cells of a
+	// row are sorted and do not overlap, and are split into chunks of at
+	// most chunkCells cells. A span is inserted by a binary search of the
+	// chunks of its row for the chunk of its first column, and a binary
+	// search of that chunk for its first cell, so the cost of finding the
+	// place of a span grows with the logarithm of the number of cells in
+	// the row, and inserting or removing cells only moves the cells of
+	// one chunk. The search is skipped when the span starts at the cell
+	// after the last cells replaced in its row.
+	//
+	// The chunks are blocks of chunkCells cells in one arena, so that
+	// the cells are not allocated one row at a time, and blocks of
+	// chunks that are emptied are kept in a free list for reuse.
+	//
+	// A row with more chunks than denseChunks, such as a row crossed by
+	// many thin overlapping lines, takes less memory and time as pixels, so
+	// it is moved into a dense row of the pix arena, with a bit in cover for
+	// each pixel that a span has covered. dense holds the index plus one of
+	// the dense row of each row, or 0 for a row of chunks.
+	//
+	// dirty lists the rows that have cells, so that reset only clears those
+	// rows when the bounds are unchanged.
+	spanList struct {
+		cells       []cell32
+		free        []int32
+		rows        [][]chunk
+		dense       []int32
+		pix         []color.RGBA
+		cover       []uint64
+		denseChunks int
+		w, words    int // the pixels and cover words of a dense row
+		bounds      image.Rectangle
+		dirty       []int32
+		// buf and tmp are reused for the cells that replace those under a
+		// span, and for the cells of the chunks that are split.
+		buf, tmp []cell32
+		// hintRow, hintC and hintK are the row, chunk and index of the cell
+		// after the last cells replaced, where the next span of a row
+		// drawn from left to right usually starts.
+		hintRow, hintC, hintK int
+	}
+)
+
+// reset empties the list and sizes it for the rows of bounds. If the bounds
+// are unchanged, only the dirty rows are cleared.
+func (s *spanList) reset(bounds image.Rectangle) {
+	if bounds == s.bounds && len(s.rows) == bounds.Dy() {
+		s.clearDirty()
+		return
+	}
+	s.bounds = bounds
+	s.denseChunks = max(3, bounds.Dx()/256)
+	s.w, s.words = bounds.Dx(), (bounds.Dx()+63)>>6
+	n := bounds.Dy()
+	if cap(s.rows) < n {
+		s.rows = append(s.rows[:cap(s.rows)], make([][]chunk, n-cap(s.rows))...)
+	}
+	s.rows = s.rows[:n]
+	for i := range s.rows {
+		s.rows[i] = s.rows[i][:0]
+	}
+	s.dense = slices.Grow(s.dense[:0], n)[:n]
+	clear(s.dense)
+	s.cells, s.free, s.dirty = s.cells[:0], s.free[:0], s.dirty[:0]
+	s.pix, s.cover = s.pix[:0], s.cover[:0]
+}
+
+// clearDirty empties the rows that have cells, and the cell and pixel arenas.
+func (s *spanList) clearDirty() {
+	for _, row := range s.dirty {
+		s.rows[row] = s.rows[row][:0]
+		s.dense[row] = 0
+	}
+	s.cells, s.free, s.dirty = s.cells[:0], s.free[:0], s.dirty[:0]
+	s.pix, s.cover = s.pix[:0], s.cover[:0]
+}
+
+// pixels returns the pixels and cover bits of a dense row, or nil for a
+// row of chunks.
+func (s *spanList) pixels(row int) ([]color.RGBA, []uint64) {
+	d := int(s.dense[row])
+	if d == 0 {
+		return nil, nil
+	}
+	return s.pix[(d-1)*s.w : d*s.w], s.cover[(d-1)*s.words : d*s.words]
+}
+
+// makeDense moves the cells of a row into a new dense row.
+func (s *spanList) makeDense(row int) {
+	s.pix = slices.Grow(s.pix, s.w)[:len(s.pix)+s.w]
+	s.cover = slices.Grow(s.cover, s.words)[:len(s.cover)+s.words]
+	s.dense[row] = int32(len(s.pix) / s.w)
+	pix, cover := s.pixels(row)
+	clear(pix)
+	clear(cover)
+	minX := s.bounds.Min.X
+	for _, c := range s.rows[row] {
+		for _, cl := range s.block(c) {
+			i0, i1 := int(cl.x0)-minX, int(cl.x1)-minX
+			for i := i0; i < i1; i++ {
+				pix[i] = cl.clr
+			}
+			setCover(cover, i0, i1)
+		}
+		s.free = append(s.free, c.b)
+	}
+	s.rows[row] = s.rows[row][:0]
+}
+
+// setCover sets the cover bits of pixels i0 to i1.
+func setCover(cover []uint64, i0, i1 int) {
+	for i0 < i1 {
+		w, b := i0>>6, uint(i0&63)
+		n := min(i1-i0, 64-int(b))
+		cover[w] |= (1<<uint(n) - 1) << b
+		i0 += n
+	}
+}
+
+// covered reports whether pixels i0 to i1 are all covered.
+func covered(cover []uint64, i0, i1 int) bool {
+	for i0 < i1 {
+		w, b := i0>>6, uint(i0&63)
+		n := min(i1-i0, 64-int(b))
+		if mask := uint64(1<<uint(n)-1) << b; cover[w]&mask != mask {
+			return false
+		}
+		i0 += n
+	}
+	return true
+}
+
+// block returns the cells of chunk c, with the capacity of its block.
+func (s *spanList) block(c chunk) []cell32 {
+	i := int(c.b) * chunkCells
+	return s.cells[i : i+int(c.n) : i+chunkCells]
+}
+
+// alloc returns a free block.
+func (s *spanList) alloc() int32 {
+	if k := len(s.free); k > 0 {
+		b := s.free[k-1]
+		s.free = s.free[:k-1]
+		return b
+	}
+	b := int32(len(s.cells) / chunkCells)
+	s.cells = slices.Grow(s.cells, chunkCells)[:len(s.cells)+chunkCells]
+	return b
+}
+
+// row returns the cells of a row, from left to right. The cells of a dense
+// row are its runs of covered pixels of the same color.
+func (s *spanList) row(row int) iter.Seq[spanCell] {
+	return func(yield func(spanCell) bool) {
+		if pix, cover := s.pixels(row); pix != nil {
+			minX := s.bounds.Min.X
+			for i := 0; i < len(pix); {
+				if cover[i>>6]&(1<<uint(i&63)) == 0 {
+					i++
+					continue
+				}
+				j := i + 1
+				for j < len(pix) && pix[j] == pix[i] && cover[j>>6]&(1<<uint(j&63)) != 0 {
+					j++
+				}
+				if !yield(spanCell{x0: i + minX, x1: j + minX, clr: pix[i]}) {
+					return
+				}
+				i = j
+			}
+			return
+		}
+		for _, c := range s.rows[row] {
+			for _, cl := range s.block(c) {
+				if !yield(spanCell{x0: int(cl.x0), x1: int(cl.x1), clr: cl.clr}) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// find returns the chunk and the index in the chunk of the first cell of a
+// row that ends after x. If no cell ends after x, it returns the end of the
+// last chunk, or chunk 0 of an empty row.
+func (s *spanList) find(row, x int) (ci, k int) {
+	chunks := s.rows[row]
+	n := len(chunks)
+	if n == 0 {
+		return 0, 0
+	}
+	if int(chunks[n-1].x1) <= x {
+		return n - 1, int(chunks[n-1].n)
+	}
+	if c, k := s.hintC, s.hintK; row == s.hintRow && c < n && k < int(chunks[c].n) {
+		cells := s.block(chunks[c])
+		if int(cells[k].x1) > x && (k > 0 && int(cells[k-1].x1) <= x ||
+			k == 0 && (c == 0 || int(chunks[c-1].x1) <= x)) {
+			return c, k
+		}
+	}
+	lo, hi := 0, n-1
+	for lo < hi {
+		h := int(uint(lo+hi) >> 1)
+		if int(chunks[h].x1) > x {
+			hi = h
+		} else {
+			lo = h + 1
+		}
+	}
+	cells := s.block(chunks[lo])
+	k, hi = 0, len(cells)
+	for k < hi {
+		h := int(uint(k+hi) >> 1)
+		if int(cells[h].x1) > x {
+			hi = h
+		} else {
+			k = h + 1
+		}
+	}
+	return lo, k
+}
+
+// replace replaces the cells of a row from cell k0 of chunk c0 up to cell k1
+// of chunk c1 with cells. Cell 0 of a chunk, or of the chunk after the last
+// one, may also be given as the end of the chunk before it.
+func (s *spanList) replace(row, c0, k0, c1, k1 int, cells []cell32) {
+	chunks := s.rows[row]
+	if k1 == 0 && c1 > c0 {
+		c1--
+		k1 = int(chunks[c1].n)
+	}
+	if c0 == c1 && c0 < len(chunks) {
+		// within one chunk, if the cells fit
+		c := &chunks[c0]
+		n := int(c.n) - (k1 - k0) + len(cells)
+		if n > 0 && n <= chunkCells {
+			blk := s.block(*c)[:chunkCells]
+			copy(blk[k0+len(cells):n], blk[k1:c.n])
+			copy(blk[k0:], cells)
+			c.n, c.x1 = int32(n), blk[n-1].x1
+			s.hintRow, s.hintC, s.hintK = row, c0, k0+len(cells)
+			return
+		}
+	}
+	// gather the cells of the chunks from c0 to c1, with cells in place
+	// of those replaced, and divide them into new chunks
+	tmp := s.tmp[:0]
+	if c0 < len(chunks) {
+		tmp = append(tmp, s.block(chunks[c0])[:k0]...)
+	}
+	tmp = append(tmp, cells...)
+	last := c1
+	if c1 < len(chunks) {
+		tmp = append(tmp, s.block(chunks[c1])[k1:]...)
+	} else {
+		last = c1 - 1
+	}
+	for _, c := range chunks[c0 : last+1] {
+		s.free = append(s.free, c.b)
+	}
+	if len(chunks) == 0 && len(tmp) > 0 {
+		s.dirty = append(s.dirty, int32(row))
+	}
+	// new chunks are filled to three quarters, so that a few cells can
+	// be inserted before they are split again
+	k := (len(tmp) + chunkCells*3/4 - 1) / (chunkCells * 3 / 4)
+	var fresh [8]chunk
+	parts := fresh[:0]
+	for i := 0; i < k; i++ {
+		part := tmp[len(tmp)*i/k : len(tmp)*(i+1)/k]
+		c := chunk{b: s.alloc(), n: int32(len(part)), x1: part[len(part)-1].x1}
+		copy(s.block(c), part)
+		parts = append(parts, c)
+	}
+	s.rows[row] = slices.Replace(chunks, c0, last+1, parts...)
+	s.tmp = tmp
+	if len(s.rows[row]) > s.denseChunks {
+		s.makeDense(row)
+	}
+}
+
+// setRow replaces the cells of a row of chunks with cells.
+func (s *spanList) setRow(row int, cells []cell32) {
+	s.replace(row, 0, 0, len(s.rows[row]), 0, cells)
+}
@@ -0,0 +1,105 @@
+package scanx_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/srwiley/rasterx"
+	"github.com/srwiley/scanx"
+)
+
+func TestWideSpanList(t *testing.T) {
+	// spans are drawn the same in bounds wider than 65535 pixels, and in
+	// bounds that start far left of the origin
+	draw := func(bounds image.Rectangle) *image.RGBA {
+		lspanner := &scanx.LinkListSpanner{}
+		lspanner.SetBounds(bounds)
+		for i, c := range []color.RGBA{{0x80, 0, 0, 0x80}, {0, 0x60, 0, 0x60}, {0, 0, 0xFF, 0xFF}, {0x20, 0x20, 0, 0x40}} {
+			fillRect(lspanner, c, image.Rect(i*9, i, i*9+30, i+5))
+		}
+		img := image.NewRGBA(image.Rect(0, 0, 64, 8))
+		lspanner.DrawToImageAt(img, bounds.Min)
+		return img
+	}
+	narrow := draw(image.Rect(0, 0, 64, 8))
+	for _, bounds := range []image.Rectangle{
+		image.Rect(-70000, 0, 64, 8),
+		image.Rect(0, 0, 70000, 8),
+	} {
+		if d := MaxPixDiff(narrow, draw(bounds)); d != 0 {
+			t.Errorf("spans in bounds %v differ by %d", bounds, d)
+		}
+	}
+}
+
+func TestIndexedRowsMatchBaseline(t *testing.T) {
+	// the indexed rows give the same bytes as the linked list rows they
+	// replaced, for rows of chunks and for rows that become dense
+	files, err := FilePathWalkDir("testdata/svg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bg := color.RGBA{0x10, 0x20, 0, 0x40}
+	for _, file := range files {
+		for _, tc := range []struct {
+			op draw.Op
+			bg color.RGBA
+		}{{draw.Over, color.RGBA{}}, {draw.Src, color.RGBA{}}, {draw.Over, bg}} {
+			width, height := 300, 300
+			bounds := image.Rect(0, 0, width, height)
+			lspanner := RenderLinkList(t, file, width, height, func(x *scanx.LinkListSpanner) {
+				x.Op = tc.op
+				x.SetBgColor(tc.bg)
+			})
+			got := image.NewRGBA(bounds)
+			lspanner.DrawToImage(got)
+
+			baseline := scanx.NewBaselineSpanner(bounds)
+			baseline.Op = tc.op
+			baseline.SetBgColor(tc.bg)
+			scanner := scanx.NewScanner(baseline, width, height)
+			ReadTestIcon(t, file, width, height).Draw(rasterx.NewDasher(width, height, scanner), 1.0)
+			want := image.NewRGBA(bounds)
+			baseline.DrawToImage(want)
+			if !bytes.Equal(got.Pix, want.Pix) {
+				t.Errorf("%s op %v bg %v: pixels differ from the baseline by up to %d", file, tc.op, tc.bg, MaxPixDiff(got, want))
+			}
+		}
+	}
+}
+
+func TestClearDirtyRows(t *testing.T) {
+	bounds := image.Rect(0, 0, 64, 48)
+	lspanner := &scanx.LinkListSpanner{}
+	lspanner.SetBounds(bounds)
+	red, blue := color.RGBA{0xFF, 0, 0, 0xFF}, color.RGBA{0, 0, 0x80, 0x80}
+	fillRect(lspanner, red, image.Rect(4, 30, 40, 40))
+	fillRect(lspanner, blue, image.Rect(10, 2, 20, 44))
+	lspanner.Clear()
+	// nothing of the first drawing is left, and the rows index still works
+	fillRect(lspanner, blue, image.Rect(8, 35, 30, 38))
+	fillRect(lspanner, red, image.Rect(0, 36, 64, 37))
+	img := image.NewRGBA(bounds)
+	lspanner.DrawToImage(img)
+
+	want := image.NewRGBA(bounds)
+	fresh := scanx.NewImgSpanner(want)
+	fillRect(fresh, blue, image.Rect(8, 35, 30, 38))
+	fillRect(fresh, red, image.Rect(0, 36, 64, 37))
+	if d := MaxPixDiff(img, want); d != 0 {
+		t.Errorf("drawing after Clear differs by %d", d)
+	}
+}
+
+func BenchmarkClearLarge(b *testing.B) {
+	lspanner := &scanx.LinkListSpanner{}
+	lspanner.SetBounds(image.Rect(0, 0, 3840, 2160))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fillRect(lspanner, color.RGBA{0xFF, 0, 0, 0xFF}, image.Rect(100, 100, 164, 164))
+		lspanner.Clear()
+	}
+}